@@ -0,0 +1,428 @@
+package crud
+
+import (
+	"database/sql"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 聚合函数
+const (
+	AggSum           = "SUM"
+	AggAvg           = "AVG"
+	AggMin           = "MIN"
+	AggMax           = "MAX"
+	AggCountDistinct = "COUNT_DISTINCT"
+)
+
+// AggValue 聚合函数的结果
+// 数据库返回NULL的时候(比如SUM没有匹配到任何行)IsNull()为true，其他方法返回零值。
+type AggValue struct {
+	raw  string
+	null bool
+	err  error
+}
+
+// IsNull 结果是否为NULL
+func (a AggValue) IsNull() bool {
+	return a.null
+}
+
+// Err 查询过程中的错误
+func (a AggValue) Err() error {
+	return a.err
+}
+
+// String 原始字符串，NULL的时候为""
+func (a AggValue) String() string {
+	return a.raw
+}
+
+// Decimal 精确的十进制值，不会丢失DECIMAL的精度，NULL或者不是数字的时候为nil
+func (a AggValue) Decimal() *big.Rat {
+	if a.null {
+		return nil
+	}
+	d, _, ok := parseDecimal(a.raw)
+	if !ok {
+		return nil
+	}
+	return d
+}
+
+// Int64 int64值，如果是小数则舍弃小数部分
+func (a AggValue) Int64() int64 {
+	if a.null {
+		return 0
+	}
+	i, err := strconv.ParseInt(a.raw, 10, 64)
+	if err == nil {
+		return i
+	}
+	f, _ := strconv.ParseFloat(a.raw, 64)
+	return int64(f)
+}
+
+// Float64 float64值
+func (a AggValue) Float64() float64 {
+	if a.null {
+		return 0
+	}
+	f, _ := strconv.ParseFloat(a.raw, 64)
+	return f
+}
+
+// Time 时间值，用于MIN/MAX时间字段，按照TimeFormat解析。
+func (a AggValue) Time() time.Time {
+	if a.null {
+		return time.Time{}
+	}
+	for _, layout := range []string{TimeFormat, "2006-01-02", time.RFC3339Nano} {
+		t, err := time.ParseInLocation(layout, a.raw, time.Local)
+		if err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// Sum SUM(field)
+func (s *Search) Sum(field string) AggValue {
+	return s.aggregate(AggSum, field)
+}
+
+// Avg AVG(field)
+func (s *Search) Avg(field string) AggValue {
+	return s.aggregate(AggAvg, field)
+}
+
+// Min MIN(field)
+func (s *Search) Min(field string) AggValue {
+	return s.aggregate(AggMin, field)
+}
+
+// Max MAX(field)
+func (s *Search) Max(field string) AggValue {
+	return s.aggregate(AggMax, field)
+}
+
+// CountDistinct COUNT(DISTINCT field)
+func (s *Search) CountDistinct(field string) AggValue {
+	return s.aggregate(AggCountDistinct, field)
+}
+
+// AggregateGroup 按照GROUP BY分组计算聚合函数，返回分组的值对应的结果。
+// groupBy会追加到已有的Group条件后面，多个分组字段的值用","连接作为key，NULL作为""。
+func (s *Search) AggregateGroup(fn, field string, groupBy ...string) (map[string]AggValue, error) {
+	query, args, keyLen := s.aggGroupQuery(fn, field, groupBy)
+	rows := s.queryRows(query, args...)
+	if rows.err != nil {
+		return nil, rows.err
+	}
+	defer rows.rows.Close()
+	out := make(map[string]AggValue)
+	for rows.rows.Next() {
+		vals := make([]sql.NullString, keyLen+1)
+		dest := make([]interface{}, keyLen+1)
+		for i := range vals {
+			dest[i] = &vals[i]
+		}
+		if err := rows.rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		keys := make([]string, keyLen)
+		for i := 0; i < keyLen; i++ {
+			keys[i] = vals[i].String
+		}
+		out[strings.Join(keys, ",")] = AggValue{raw: vals[keyLen].String, null: !vals[keyLen].Valid}
+	}
+	if err := rows.rows.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// aggGroupQuery 生成AggregateGroup的SQL，keyLen为分组字段的个数。
+func (s *Search) aggGroupQuery(fn, field string, groupBy []string) (query string, args []interface{}, keyLen int) {
+	ns := s.aggSearch()
+	ns.groupConditions = append(ns.groupConditions, groupBy...)
+	for i, g := range ns.groupConditions {
+		ns.fields = append(ns.fields, fmt.Sprintf("%s AS agg_key%d", g, i))
+	}
+	ns.fields = append(ns.fields, aggExpr(fn, field)+" AS agg")
+	query, args = ns.Parse()
+	return query, args, len(ns.groupConditions)
+}
+
+// aggregate 计算单个聚合值
+func (s *Search) aggregate(fn, field string) AggValue {
+	query, args := s.aggQuery(fn, field)
+	return queryAggValue(s.queryRows(query, args...))
+}
+
+// aggQuery 生成单个聚合值的SQL
+// 如果有GROUP BY，会先按组计算再在外层汇总，这样HAVING过滤掉的组不会被计算进去。
+// COUNT_DISTINCT不能按组汇总(同一个值可能出现在多个组中)，所以直接在所有行上计算，
+// 有HAVING的时候只计算HAVING之后还存在的组中的行。
+func (s *Search) aggQuery(fn, field string) (string, []interface{}) {
+	ns := s.aggSearch()
+	if len(ns.groupConditions) == 0 {
+		ns.fields = []string{aggExpr(fn, field) + " AS agg"}
+		return ns.Parse()
+	}
+	var outer string
+	switch fn {
+	case AggAvg:
+		ns.fields = []string{fmt.Sprintf("SUM(%s) AS agg_sum", field), fmt.Sprintf("COUNT(%s) AS agg_count", field)}
+		outer = "SUM(agg_sum)/SUM(agg_count)"
+	case AggCountDistinct:
+		if len(ns.havingConditions) > 0 {
+			groups := ns.Clone()
+			conds := make([]string, len(groups.groupConditions))
+			for i, g := range groups.groupConditions {
+				groups.fields = append(groups.fields, fmt.Sprintf("%s AS agg_key%d", g, i))
+				conds[i] = fmt.Sprintf("agg_group.agg_key%d <=> %s", i, g)
+			}
+			query, args := groups.Parse()
+			ns.whereConditions = append(ns.whereConditions, WhereCon{
+				Query: fmt.Sprintf("EXISTS (SELECT 1 FROM (%s) AS agg_group WHERE %s)", query, strings.Join(conds, " AND ")),
+				Args:  args,
+			})
+		}
+		ns.groupConditions = nil
+		ns.havingConditions = nil
+		ns.fields = []string{aggExpr(fn, field) + " AS agg"}
+		return ns.Parse()
+	case AggMin, AggMax:
+		ns.fields = []string{aggExpr(fn, field) + " AS agg"}
+		outer = fn + "(agg)"
+	default:
+		ns.fields = []string{aggExpr(fn, field) + " AS agg"}
+		outer = "SUM(agg)"
+	}
+	query, args := ns.Parse()
+	return fmt.Sprintf("SELECT %s AS agg FROM (%s) AS agg_group", outer, query), args
+}
+
+// aggSearch 去掉和聚合无关的条件
+func (s *Search) aggSearch() *Search {
+	ns := s.Clone()
+	ns.fields = nil
+	ns.orderbyConditions = nil
+	ns.limit = nil
+	ns.offset = nil
+	return ns
+}
+
+func aggExpr(fn, field string) string {
+	if fn == AggCountDistinct {
+		return fmt.Sprintf("COUNT(DISTINCT %s)", field)
+	}
+	return fmt.Sprintf("%s(%s)", fn, field)
+}
+
+// queryAggValue 读取查询结果的第一行第一列，保留NULL
+func queryAggValue(rows *SQLRows) AggValue {
+	if rows.err != nil {
+		return AggValue{null: true, err: rows.err}
+	}
+	defer rows.rows.Close()
+	var v sql.NullString
+	if rows.rows.Next() {
+		if err := rows.rows.Scan(&v); err != nil {
+			return AggValue{null: true, err: err}
+		}
+	}
+	return AggValue{raw: v.String, null: !v.Valid, err: rows.rows.Err()}
+}
+
+// 只用于RowsMap.Aggregate的聚合函数
+const (
+	AggCount = "COUNT"
+	AggFirst = "FIRST"
+	AggLast  = "LAST"
+)
+
+// Agg RowsMap.Aggregate中的一个聚合项
+type Agg struct {
+	Func  string // AggCount、AggSum、AggAvg、AggMin、AggMax、AggCountDistinct、AggFirst、AggLast
+	Field string // AggCount的Field为空或者*时统计行数
+	As    string // 结果的字段名，默认为小写的Func_Field，比如sum_amount
+}
+
+func (a Agg) name() string {
+	if a.As != "" {
+		return a.As
+	}
+	if a.Field == "" || a.Field == "*" {
+		return strings.ToLower(a.Func)
+	}
+	return strings.ToLower(a.Func) + "_" + a.Field
+}
+
+// Aggregate 在内存中按照groupBy分组后计算聚合，用于合并分库分表或者多个数据源的结果后再统计。
+// 返回的每一行包含groupBy中的字段以及每个聚合项，分组的顺序为第一次出现的顺序，groupBy为空时返回一行。
+// 和SQL一样""被当作NULL：SUM、AVG、MIN、MAX、COUNT(field)、COUNT_DISTINCT会忽略""，没有值的时候SUM、AVG、MIN、MAX为""。
+// SUM、AVG使用精确的十进制计算，不会有浮点数误差，AVG比参与计算的值多保留4位小数(和MySQL一样)。
+// MIN、MAX在所有值都是数字的时候按照数字比较，否则按照字符串比较；不是数字的值不参与SUM、AVG。
+func (rm RowsMap) Aggregate(groupBy []string, aggs ...Agg) RowsMap {
+	type group struct {
+		key  RowMap
+		rows RowsMap
+	}
+	var (
+		groups []*group
+		index  = map[string]*group{}
+	)
+	if len(groupBy) == 0 {
+		groups = append(groups, &group{key: RowMap{}, rows: rm})
+	} else {
+		for _, r := range rm {
+			vals := make([]string, len(groupBy))
+			for i, field := range groupBy {
+				vals[i] = r[field]
+			}
+			k := strings.Join(vals, "\x00")
+			g, ok := index[k]
+			if !ok {
+				g = &group{key: RowMap{}}
+				for i, field := range groupBy {
+					g.key[field] = vals[i]
+				}
+				index[k] = g
+				groups = append(groups, g)
+			}
+			g.rows = append(g.rows, r)
+		}
+	}
+	out := make(RowsMap, 0, len(groups))
+	for _, g := range groups {
+		nr := make(RowMap, len(groupBy)+len(aggs))
+		for k, v := range g.key {
+			nr[k] = v
+		}
+		for _, a := range aggs {
+			nr[a.name()] = g.rows.aggregate(a)
+		}
+		out = append(out, nr)
+	}
+	return out
+}
+
+// aggregate 计算单个聚合项
+func (rm RowsMap) aggregate(a Agg) string {
+	switch a.Func {
+	case AggCount:
+		if a.Field == "" || a.Field == "*" {
+			return strconv.Itoa(len(rm))
+		}
+		n := 0
+		for _, r := range rm {
+			if r[a.Field] != "" {
+				n++
+			}
+		}
+		return strconv.Itoa(n)
+	case AggCountDistinct:
+		set := map[string]bool{}
+		for _, r := range rm {
+			if v := r[a.Field]; v != "" {
+				set[v] = true
+			}
+		}
+		return strconv.Itoa(len(set))
+	case AggFirst:
+		if len(rm) == 0 {
+			return ""
+		}
+		return rm[0][a.Field]
+	case AggLast:
+		if len(rm) == 0 {
+			return ""
+		}
+		return rm[len(rm)-1][a.Field]
+	case AggSum, AggAvg:
+		var (
+			sum   = new(big.Rat)
+			n     int64
+			scale int
+		)
+		for _, r := range rm {
+			d, s, ok := parseDecimal(r[a.Field])
+			if !ok {
+				continue
+			}
+			sum.Add(sum, d)
+			n++
+			if s > scale {
+				scale = s
+			}
+		}
+		if n == 0 {
+			return ""
+		}
+		if a.Func == AggAvg {
+			return formatDecimal(sum.Quo(sum, new(big.Rat).SetInt64(n)), scale+4)
+		}
+		return formatDecimal(sum, scale)
+	case AggMin, AggMax:
+		vals := []string{}
+		numeric := true
+		for _, r := range rm {
+			v := r[a.Field]
+			if v == "" {
+				continue
+			}
+			if _, _, ok := parseDecimal(v); !ok {
+				numeric = false
+			}
+			vals = append(vals, v)
+		}
+		if len(vals) == 0 {
+			return ""
+		}
+		best := vals[0]
+		for _, v := range vals[1:] {
+			var c int
+			if numeric {
+				x, _, _ := parseDecimal(v)
+				y, _, _ := parseDecimal(best)
+				c = x.Cmp(y)
+			} else {
+				c = strings.Compare(v, best)
+			}
+			if a.Func == AggMin && c < 0 || a.Func == AggMax && c > 0 {
+				best = v
+			}
+		}
+		return best
+	}
+	return ""
+}
+
+// parseDecimal 解析十进制数字，scale为小数位数。
+func parseDecimal(s string) (*big.Rat, int, bool) {
+	s = strings.TrimSpace(s)
+	if s == "" || strings.ContainsAny(s, "/eE") {
+		return nil, 0, false
+	}
+	d, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return nil, 0, false
+	}
+	scale := 0
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		scale = len(s) - i - 1
+	}
+	return d, scale, true
+}
+
+func formatDecimal(d *big.Rat, scale int) string {
+	if scale == 0 && d.IsInt() {
+		return d.Num().String()
+	}
+	return d.FloatString(scale)
+}
@@ -0,0 +1,82 @@
+package crud
+
+import (
+	"math/big"
+	"reflect"
+	"testing"
+)
+
+func TestSearch_AggQuery(t *testing.T) {
+	db := newTestDataBase(map[string][]string{
+		"order": {"id", "user_id", "amount", "status", "is_deleted"},
+		"user":  {"id", "city"},
+	})
+	base := func() *Search {
+		return db.Table("order").Joins("user", "user.id = order.user_id").Where("status = ?", 1).OrderBy("id").Limit(3).Search
+	}
+	tests := []struct {
+		name   string
+		search *Search
+		fn     string
+		want   string
+		args   []interface{}
+	}{
+		{"sum", base(), AggSum,
+			"SELECT SUM(amount) AS agg FROM `order` LEFT JOIN user ON user.id = order.user_id WHERE status = ? AND is_deleted = ?",
+			[]interface{}{1, 0}},
+		{"count distinct", base(), AggCountDistinct,
+			"SELECT COUNT(DISTINCT amount) AS agg FROM `order` LEFT JOIN user ON user.id = order.user_id WHERE status = ? AND is_deleted = ?",
+			[]interface{}{1, 0}},
+		{"group sum", base().Group("user_id").Having("COUNT(*) > ?", 2), AggSum,
+			"SELECT SUM(agg) AS agg FROM (SELECT SUM(amount) AS agg FROM `order` LEFT JOIN user ON user.id = order.user_id WHERE status = ? AND is_deleted = ? GROUP BY user_id HAVING COUNT(*) > ?) AS agg_group",
+			[]interface{}{1, 0, 2}},
+		{"group avg", base().Group("user_id"), AggAvg,
+			"SELECT SUM(agg_sum)/SUM(agg_count) AS agg FROM (SELECT SUM(amount) AS agg_sum,COUNT(amount) AS agg_count FROM `order` LEFT JOIN user ON user.id = order.user_id WHERE status = ? AND is_deleted = ? GROUP BY user_id) AS agg_group",
+			[]interface{}{1, 0}},
+		{"group max", base().Group("user_id"), AggMax,
+			"SELECT MAX(agg) AS agg FROM (SELECT MAX(amount) AS agg FROM `order` LEFT JOIN user ON user.id = order.user_id WHERE status = ? AND is_deleted = ? GROUP BY user_id) AS agg_group",
+			[]interface{}{1, 0}},
+		{"group count distinct", base().Group("user_id"), AggCountDistinct,
+			"SELECT COUNT(DISTINCT amount) AS agg FROM `order` LEFT JOIN user ON user.id = order.user_id WHERE status = ? AND is_deleted = ?",
+			[]interface{}{1, 0}},
+		{"having count distinct", base().Group("user_id").Having("COUNT(*) > ?", 2), AggCountDistinct,
+			"SELECT COUNT(DISTINCT amount) AS agg FROM `order` LEFT JOIN user ON user.id = order.user_id WHERE status = ? AND " +
+				"EXISTS (SELECT 1 FROM (SELECT `order`.`user_id` AS agg_key0 FROM `order` LEFT JOIN user ON user.id = order.user_id WHERE status = ? AND is_deleted = ? GROUP BY user_id HAVING COUNT(*) > ?) AS agg_group WHERE agg_group.agg_key0 <=> user_id) AND is_deleted = ?",
+			[]interface{}{1, 1, 0, 2, 0}},
+	}
+	for _, tt := range tests {
+		query, args := tt.search.aggQuery(tt.fn, "amount")
+		if query != tt.want || !reflect.DeepEqual(args, tt.args) {
+			t.Errorf("%s: aggQuery() = %s %v, want %s %v", tt.name, query, args, tt.want, tt.args)
+		}
+	}
+}
+
+func TestSearch_AggGroupQuery(t *testing.T) {
+	db := newTestDataBase(map[string][]string{"order": {"id", "user_id", "amount", "status"}, "user": {"id", "city"}})
+	query, args, keyLen := db.Table("order").Where("status = ?", 1).Group("status").aggGroupQuery(AggSum, "amount", []string{"user.city"})
+	want := "SELECT `order`.`status` AS agg_key0,`user`.`city` AS agg_key1,SUM(amount) AS agg FROM `order` LEFT JOIN user ON order.user_id = user.id WHERE status = ? GROUP BY status,user.city"
+	if query != want || !reflect.DeepEqual(args, []interface{}{1}) || keyLen != 2 {
+		t.Fatalf("aggGroupQuery() = %s %v %d, want %s", query, args, keyLen, want)
+	}
+}
+
+func TestAggValue(t *testing.T) {
+	null := AggValue{null: true}
+	if !null.IsNull() || null.String() != "" || null.Int64() != 0 || null.Float64() != 0 || !null.Time().IsZero() || null.Decimal() != nil {
+		t.Fatalf("NULL AggValue = %v %q %d %v %v %v", null.IsNull(), null.String(), null.Int64(), null.Float64(), null.Time(), null.Decimal())
+	}
+	v := AggValue{raw: "12345678901234567.89"}
+	if v.IsNull() || v.Int64() != 12345678901234568 {
+		t.Fatalf("AggValue.Int64() = %d", v.Int64())
+	}
+	if d := v.Decimal(); d == nil || d.Cmp(big.NewRat(1234567890123456789, 100)) != 0 {
+		t.Fatalf("AggValue.Decimal() = %v", d)
+	}
+	if d := (AggValue{raw: "2021-01-02 03:04:05"}).Decimal(); d != nil {
+		t.Fatalf("AggValue.Decimal() of a time = %v, want nil", d)
+	}
+	if tm := (AggValue{raw: "2021-01-02 03:04:05"}).Time(); tm.Year() != 2021 || tm.Second() != 5 {
+		t.Fatalf("AggValue.Time() = %v", tm)
+	}
+}
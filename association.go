@@ -0,0 +1,456 @@
+package crud
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// 关联的类型，在结构体tag中声明
+//
+//	Profile  *Profile  `crud:"has_one,foreign_key=user_id"`
+//	Comments []Comment `crud:"has_many,foreign_key=post_id,references=id"`
+//	Author   *User     `crud:"belongs_to,foreign_key=author_id,references=id"`
+//	Tags     []Tag     `crud:"many2many=post_tag,join_foreign_key=post_id,join_references=tag_id"`
+//
+// has_one、has_many的foreign_key为关联表中的列，默认为本结构体名_id，references为本表中的列，默认为主键；
+// belongs_to的foreign_key为本表中的列，默认为字段名_id，references为关联表中的列，默认为主键；
+// many2many的值为中间表，join_foreign_key为中间表中对应本表的列，默认为本结构体名_id，
+// join_references为中间表中对应关联表的列，默认为关联结构体名_id，references为本表中的列，默认为主键。
+const (
+	HasOne    = "has_one"
+	HasMany   = "has_many"
+	BelongsTo = "belongs_to"
+	Many2Many = "many2many"
+)
+
+// ErrAssociation 关联的声明和表结构不一致
+var ErrAssociation = errors.New("关联错误")
+
+// relation 结构体tag中声明的关联
+type relation struct {
+	kind           string
+	foreignKey     string
+	references     string
+	joinTable      string
+	joinForeignKey string
+	joinReferences string
+	elem           reflect.Type // 关联的结构体类型
+}
+
+// parseRelation 解析字段f的crud tag，owner为字段所在的结构体，没有声明关联的时候返回nil。
+func parseRelation(tag string, owner reflect.Type, f *modelField) *relation {
+	elem := f.typ
+	if elem.Kind() == reflect.Ptr {
+		elem = elem.Elem()
+	}
+	if elem.Kind() == reflect.Slice {
+		elem = elem.Elem()
+		if elem.Kind() == reflect.Ptr {
+			elem = elem.Elem()
+		}
+	}
+	if elem.Kind() != reflect.Struct {
+		return nil
+	}
+	rel := &relation{elem: elem}
+	for _, opt := range strings.Split(tag, ",") {
+		kv := strings.SplitN(strings.TrimSpace(opt), "=", 2)
+		val := ""
+		if len(kv) == 2 {
+			val = strings.TrimSpace(kv[1])
+		}
+		switch kv[0] {
+		case HasOne, HasMany, BelongsTo:
+			rel.kind = kv[0]
+		case Many2Many:
+			rel.kind = Many2Many
+			rel.joinTable = val
+		case "foreign_key":
+			rel.foreignKey = val
+		case "references":
+			rel.references = val
+		case "join_foreign_key":
+			rel.joinForeignKey = val
+		case "join_references":
+			rel.joinReferences = val
+		}
+	}
+	switch rel.kind {
+	case "":
+		return nil
+	case BelongsTo:
+		if rel.foreignKey == "" {
+			rel.foreignKey = ToDBName(f.name) + "_id"
+		}
+	case Many2Many:
+		if rel.joinTable == "" {
+			rel.joinTable = ToDBName(owner.Name()) + "_" + ToDBName(elem.Name())
+		}
+		if rel.joinForeignKey == "" {
+			rel.joinForeignKey = ToDBName(owner.Name()) + "_id"
+		}
+		if rel.joinReferences == "" {
+			rel.joinReferences = ToDBName(elem.Name()) + "_id"
+		}
+	default:
+		if rel.foreignKey == "" {
+			rel.foreignKey = ToDBName(owner.Name()) + "_id"
+		}
+	}
+	return rel
+}
+
+// relationTables 关联的本表和关联表
+func relationTables(owner reflect.Type, rel *relation) (ownTable, targetTable string) {
+	return getStructDBName(reflect.New(owner)), getStructDBName(reflect.New(rel.elem))
+}
+
+// relationKeys 本表中用于查询关联的列，以及关联表(many2many为中间表)中对应的列。
+func (db *DataBase) relationKeys(owner reflect.Type, rel *relation) (ownKey, targetKey string) {
+	ownTable, targetTable := relationTables(owner, rel)
+	switch rel.kind {
+	case BelongsTo:
+		if rel.references == "" {
+			return rel.foreignKey, db.pkColumn(rel.elem, targetTable)
+		}
+		return rel.foreignKey, rel.references
+	case Many2Many:
+		ownKey = rel.references
+		if ownKey == "" {
+			ownKey = db.pkColumn(owner, ownTable)
+		}
+		return ownKey, rel.joinForeignKey
+	}
+	ownKey = rel.references
+	if ownKey == "" {
+		ownKey = db.pkColumn(owner, ownTable)
+	}
+	return ownKey, rel.foreignKey
+}
+
+// pkColumn 结构体t在表tableName中的第一个主键列
+func (db *DataBase) pkColumn(t reflect.Type, tableName string) string {
+	if pks, _ := getModel(t).primaryKeys(db.tableColumns[tableName]); len(pks) > 0 {
+		return pks[0].column
+	}
+	return defaultPKDB
+}
+
+// Register 检查结构体中声明的关联和表结构是否一致，models为结构体或者结构体的指针。
+// 关联表、中间表以及关联用到的列不存在的时候返回ErrAssociation。
+func (db *DataBase) Register(models ...interface{}) error {
+	for _, model := range models {
+		t := reflect.TypeOf(model)
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		ms := getModel(t)
+		for _, f := range ms.relations {
+			if err := db.checkRelation(ms, f); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (db *DataBase) checkRelation(ms *modelStruct, f *modelField) error {
+	rel := f.rel
+	ownTable, targetTable := relationTables(ms.typ, rel)
+	ownKey, targetKey := db.relationKeys(ms.typ, rel)
+	errorf := func(format string, args ...interface{}) error {
+		return fmt.Errorf("%w: %s.%s %s", ErrAssociation, ms.typ.Name(), f.name, fmt.Sprintf(format, args...))
+	}
+	for _, table := range []string{ownTable, targetTable} {
+		if !db.haveTablename(table) {
+			return errorf("表%s不存在", table)
+		}
+	}
+	if _, ok := ms.byColumn[ownKey]; !ok || !db.tableColumns[ownTable].HaveColumn(ownKey) {
+		return errorf("列%s.%s不存在", ownTable, ownKey)
+	}
+	if rel.kind != Many2Many {
+		if !db.tableColumns[targetTable].HaveColumn(targetKey) {
+			return errorf("列%s.%s不存在", targetTable, targetKey)
+		}
+		return nil
+	}
+	if !db.haveTablename(rel.joinTable) {
+		return errorf("中间表%s不存在", rel.joinTable)
+	}
+	for _, col := range []string{rel.joinForeignKey, rel.joinReferences} {
+		if !db.tableColumns[rel.joinTable].HaveColumn(col) {
+			return errorf("列%s.%s不存在", rel.joinTable, col)
+		}
+	}
+	if pk := db.pkColumn(rel.elem, targetTable); !db.tableColumns[targetTable].HaveColumn(pk) {
+		return errorf("列%s.%s不存在", targetTable, pk)
+	}
+	return nil
+}
+
+// Associations 返回一个FindAll时只查询、Create和Update时只保存names中的关联的DataBase，
+// names为字段名，不传的时候不处理任何关联。没有调用的时候处理结构体中声明的所有关联。
+func (db *DataBase) Associations(names ...string) *DataBase {
+	ndb := db.clone()
+	ndb.associations = make(map[string]bool, len(names))
+	for _, name := range names {
+		ndb.associations[name] = true
+	}
+	return ndb
+}
+
+// Preload 返回一个Find时会批量查询关联的DataBase，paths为声明了关联的字段名，嵌套的关联用.连接。
+// db.Preload("Comments", "Comments.Author").Find(&posts)
+// 每个关联只用一条IN查询(many2many先查中间表再查关联表)，超过BatchSize个值的时候分批查询。
+func (db *DataBase) Preload(paths ...string) *DataBase {
+	ndb := db.clone()
+	ndb.preloads = append(append([]string{}, db.preloads...), paths...)
+	return ndb
+}
+
+// relationFields FindAll、Create、Update时需要处理的关联，见Associations。
+func (db *DataBase) relationFields(ms *modelStruct) []*modelField {
+	fields := []*modelField{}
+	for _, f := range ms.relations {
+		if db.associations == nil || db.associations[f.name] {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+// relationNames FindAll时需要查询的关联的字段名
+func (db *DataBase) relationNames(ms *modelStruct) []string {
+	names := []string{}
+	for _, f := range db.relationFields(ms) {
+		names = append(names, f.name)
+	}
+	return names
+}
+
+// preload 批量查询owners中paths对应的关联，owners为同一类型并且可以寻址的结构体。
+func (db *DataBase) preload(owners []reflect.Value, paths []string) error {
+	if len(owners) == 0 || len(paths) == 0 {
+		return nil
+	}
+	ms := getModel(owners[0].Type())
+	names := []string{}
+	nested := map[string][]string{}
+	for _, path := range paths {
+		name, sub := path, ""
+		if i := strings.IndexByte(path, '.'); i >= 0 {
+			name, sub = path[:i], path[i+1:]
+		}
+		if _, ok := nested[name]; !ok {
+			names = append(names, name)
+			nested[name] = nil
+		}
+		if sub != "" {
+			nested[name] = append(nested[name], sub)
+		}
+	}
+	for _, name := range names {
+		f, ok := ms.byName[name]
+		if !ok || f.rel == nil {
+			return fmt.Errorf("%w: %s.%s 没有声明关联", ErrAssociation, ms.typ.Name(), name)
+		}
+		if err := db.preloadRelation(owners, ms, f); err != nil {
+			return err
+		}
+		if err := db.preload(relatedStructs(owners, f), nested[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// preloadRelation 批量查询owners的一个关联并赋值给字段
+func (db *DataBase) preloadRelation(owners []reflect.Value, ms *modelStruct, f *modelField) error {
+	rel := f.rel
+	_, targetTable := relationTables(ms.typ, rel)
+	ownKey, targetKey := db.relationKeys(ms.typ, rel)
+	of, ok := ms.byColumn[ownKey]
+	if !ok {
+		return fmt.Errorf("%w: %s.%s 列%s不存在", ErrAssociation, ms.typ.Name(), f.name, ownKey)
+	}
+	keys := []interface{}{}
+	seen := map[string]bool{}
+	for _, owner := range owners {
+		fv := owner.FieldByIndex(of.index)
+		if k := keyString(fv); !isBlank(fv) && !seen[k] {
+			seen[k] = true
+			keys = append(keys, fv.Interface())
+		}
+	}
+
+	groups := map[string][]reflect.Value{}
+	if rel.kind == Many2Many {
+		// 先查中间表，再按照关联表的主键查询
+		pairs := RowsMap{}
+		for _, chunk := range chunkArgs(keys, db.getBatchSize()) {
+			query, args := db.Table(rel.joinTable).Fields("`"+rel.joinForeignKey+"`", "`"+rel.joinReferences+"`").In("`"+rel.joinForeignKey+"`", chunk...).Parse()
+			pairs = append(pairs, db.Query(query, args...).RowsMap()...)
+		}
+		pk := db.pkColumn(rel.elem, targetTable)
+		refs := []interface{}{}
+		seen = map[string]bool{}
+		for _, pair := range pairs {
+			if ref := pair[rel.joinReferences]; !seen[ref] {
+				seen[ref] = true
+				refs = append(refs, ref)
+			}
+		}
+		rows, err := db.findIn(rel.elem, targetTable, pk, refs)
+		if err != nil {
+			return err
+		}
+		pf, ok := getModel(rel.elem).byColumn[pk]
+		if !ok {
+			return fmt.Errorf("%w: %s 列%s不存在", ErrAssociation, rel.elem.Name(), pk)
+		}
+		targets := make(map[string]reflect.Value, len(rows))
+		for _, row := range rows {
+			targets[keyString(row.Elem().FieldByIndex(pf.index))] = row
+		}
+		for _, pair := range pairs {
+			if row, ok := targets[pair[rel.joinReferences]]; ok {
+				groups[pair[rel.joinForeignKey]] = append(groups[pair[rel.joinForeignKey]], row)
+			}
+		}
+	} else {
+		tf, ok := getModel(rel.elem).byColumn[targetKey]
+		if !ok {
+			return fmt.Errorf("%w: %s 列%s不存在", ErrAssociation, rel.elem.Name(), targetKey)
+		}
+		rows, err := db.findIn(rel.elem, targetTable, targetKey, keys)
+		if err != nil {
+			return err
+		}
+		for _, row := range rows {
+			k := keyString(row.Elem().FieldByIndex(tf.index))
+			groups[k] = append(groups[k], row)
+		}
+	}
+	for _, owner := range owners {
+		fv := owner.FieldByIndex(of.index)
+		var rows []reflect.Value
+		if !isBlank(fv) {
+			rows = groups[keyString(fv)]
+		}
+		setRelated(owner.FieldByIndex(f.index), rows)
+	}
+	return nil
+}
+
+// findIn 使用IN分批查询column在keys中的行，返回*T，会调用AfterFind。
+func (db *DataBase) findIn(elem reflect.Type, tableName, column string, keys []interface{}) ([]reflect.Value, error) {
+	out := []reflect.Value{}
+	for _, chunk := range chunkArgs(keys, db.getBatchSize()) {
+		query, args := db.Table(tableName).In("`"+tableName+"`.`"+column+"`", chunk...).Parse()
+		rows := reflect.New(reflect.SliceOf(reflect.PtrTo(elem)))
+		if err := db.Query(query, args...).Find(rows.Interface()); err != nil {
+			return out, err
+		}
+		for i := 0; i < rows.Elem().Len(); i++ {
+			row := rows.Elem().Index(i)
+			if err := db.callHook(row, AfterFind); err != nil {
+				return out, err
+			}
+			out = append(out, row)
+		}
+	}
+	return out, nil
+}
+
+// chunkArgs 将args按照size分组
+func chunkArgs(args []interface{}, size int) [][]interface{} {
+	chunks := [][]interface{}{}
+	for size > 0 && len(args) > size {
+		chunks = append(chunks, args[:size:size])
+		args = args[size:]
+	}
+	if len(args) > 0 {
+		chunks = append(chunks, args)
+	}
+	return chunks
+}
+
+// keyString 用于匹配关联的值，见driverValue。
+func keyString(v reflect.Value) string {
+	switch val := driverValue(v).(type) {
+	case nil:
+		return ""
+	case []byte:
+		return string(val)
+	default:
+		return fmt.Sprint(val)
+	}
+}
+
+// driverValue 字段的值，指针使用指向的值，driver.Valuer使用Value()，nil的指针为nil。
+func driverValue(v reflect.Value) interface{} {
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	val := v.Interface()
+	if valuer, ok := val.(driver.Valuer); ok {
+		dv, err := valuer.Value()
+		if err != nil {
+			return nil
+		}
+		return dv
+	}
+	return val
+}
+
+// relatedStructs 关联字段中的结构体，用于查询嵌套的关联。
+func relatedStructs(owners []reflect.Value, f *modelField) []reflect.Value {
+	out := []reflect.Value{}
+	for _, owner := range owners {
+		fv := owner.FieldByIndex(f.index)
+		if fv.Kind() == reflect.Slice {
+			for i := 0; i < fv.Len(); i++ {
+				if ev := reflect.Indirect(fv.Index(i)); ev.IsValid() {
+					out = append(out, ev)
+				}
+			}
+			continue
+		}
+		if ev := reflect.Indirect(fv); ev.IsValid() {
+			out = append(out, ev)
+		}
+	}
+	return out
+}
+
+// setRelated 将查询出来的*T赋值给关联字段，字段可以是T、*T、[]T、[]*T，单个的时候使用第一个。
+func setRelated(field reflect.Value, rows []reflect.Value) {
+	if field.Kind() == reflect.Slice {
+		out := reflect.MakeSlice(field.Type(), 0, len(rows))
+		for _, row := range rows {
+			out = reflect.Append(out, relatedValue(row, field.Type().Elem()))
+		}
+		field.Set(out)
+		return
+	}
+	if len(rows) == 0 {
+		field.Set(reflect.Zero(field.Type()))
+		return
+	}
+	field.Set(relatedValue(rows[0], field.Type()))
+}
+
+// relatedValue *T转换成字段需要的T或者*T
+func relatedValue(v reflect.Value, t reflect.Type) reflect.Value {
+	if t.Kind() == reflect.Ptr {
+		return v
+	}
+	return v.Elem()
+}
@@ -0,0 +1,101 @@
+package crud
+
+import (
+	"database/sql"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type AssocArticle struct {
+	ID       int64
+	WriterID int64
+	Writer   *AssocWriter   `crud:"belongs_to"`
+	Notes    []AssocNote    `crud:"has_many"`
+	Labels   []*AssocLabel  `crud:"many2many=article_label"`
+	Cover    AssocCover     `crud:"has_one,foreign_key=owner_id"`
+	Others   []AssocArticle `crud:"-"`
+}
+
+type AssocWriter struct {
+	ID   int64
+	Name string
+}
+
+type AssocNote struct {
+	ID             int64
+	AssocArticleID int64
+}
+
+type AssocLabel struct {
+	ID int64
+}
+
+type AssocCover struct {
+	ID      int64
+	OwnerID int64
+}
+
+func TestRegister(t *testing.T) {
+	ms := getModel(reflect.TypeOf(AssocArticle{}))
+	names := []string{}
+	for _, f := range ms.relations {
+		names = append(names, f.name)
+	}
+	if !reflect.DeepEqual(names, []string{"Writer", "Notes", "Labels", "Cover"}) {
+		t.Fatalf("getModel() relations = %v", names)
+	}
+	labels := ms.byName["Labels"].rel
+	if labels.kind != Many2Many || labels.joinTable != "article_label" || labels.joinForeignKey != "assoc_article_id" || labels.joinReferences != "assoc_label_id" {
+		t.Fatalf("parseRelation() many2many = %+v", labels)
+	}
+	if fk := ms.byName["Writer"].rel.foreignKey; fk != "writer_id" {
+		t.Fatalf("parseRelation() belongs_to foreign_key = %s", fk)
+	}
+
+	tables := map[string][]string{
+		"assoc_article": {"id", "writer_id"},
+		"assoc_writer":  {"id", "name"},
+		"assoc_note":    {"id", "assoc_article_id"},
+		"assoc_label":   {"id"},
+		"article_label": {"assoc_article_id", "assoc_label_id"},
+		"assoc_cover":   {"id", "owner_id"},
+	}
+	db := newTestDataBase(tables)
+	if err := db.Register(&AssocArticle{}); err != nil {
+		t.Fatalf("Register() err = %v", err)
+	}
+	tables["assoc_cover"] = []string{"id"}
+	if err := newTestDataBase(tables).Register(AssocArticle{}); !errors.Is(err, ErrAssociation) {
+		t.Fatalf("Register() err = %v, want ErrAssociation", err)
+	}
+
+	if db.associations != nil || db.Associations("Notes").associations["Notes"] != true || db.associations != nil {
+		t.Fatal("Associations() should return a copy")
+	}
+}
+
+func TestPreloadHelpers(t *testing.T) {
+	chunks := chunkArgs([]interface{}{1, 2, 3, 4, 5}, 2)
+	if !reflect.DeepEqual(chunks, [][]interface{}{{1, 2}, {3, 4}, {5}}) {
+		t.Fatalf("chunkArgs() = %v", chunks)
+	}
+	id := int64(7)
+	for _, v := range []interface{}{7, &id, sql.NullInt64{Int64: 7, Valid: true}, []byte("7")} {
+		if k := keyString(reflect.ValueOf(v)); k != "7" {
+			t.Fatalf("keyString(%#v) = %s", v, k)
+		}
+	}
+
+	articles := []AssocArticle{{ID: 1}, {ID: 2}}
+	owners := structValues(reflect.ValueOf(articles))
+	ms := getModel(reflect.TypeOf(AssocArticle{}))
+	setRelated(owners[0].FieldByIndex(ms.byName["Notes"].index), []reflect.Value{reflect.ValueOf(&AssocNote{ID: 10}), reflect.ValueOf(&AssocNote{ID: 11})})
+	setRelated(owners[1].FieldByIndex(ms.byName["Writer"].index), []reflect.Value{reflect.ValueOf(&AssocWriter{ID: 3})})
+	if len(articles[0].Notes) != 2 || articles[0].Notes[1].ID != 11 || articles[1].Writer.ID != 3 {
+		t.Fatalf("setRelated() = %+v", articles)
+	}
+	if notes := relatedStructs(owners, ms.byName["Notes"]); len(notes) != 2 || !notes[0].CanAddr() {
+		t.Fatalf("relatedStructs() = %v", notes)
+	}
+}
@@ -0,0 +1,203 @@
+package crud
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ChunkOption ChunkByID的参数
+type ChunkOption struct {
+	Key     string      // 主键，默认为表结构中的主键(没有时为id)，联合主键需要指定
+	After   interface{} // 从这个主键之后开始处理，用于中断之后继续
+	Workers int         // 并发处理的goroutine数量，小于等于1的时候顺序处理
+}
+
+// Chunk 按照主键的顺序分批处理表中符合当前条件的数据，每批size条。
+func (t *Table) Chunk(size int, f func(rows RowsMap) error) error {
+	return t.ChunkByID(size, f)
+}
+
+// ChunkByID 按照主键的顺序分批处理表中符合当前条件的数据，每批size条。
+// 使用WHERE key > last ORDER BY key LIMIT size的方式翻页，开始的时候会记录最大的主键，
+// 之后新插入的数据不会被处理，所以在处理过程中有插入也是稳定的。
+// 有GROUP BY或者HAVING的时候会把当前的查询当作子查询，key需要在查询的字段中。
+// 回调返回ErrBreak时提前结束并返回nil，返回其他错误时结束并返回这个错误。
+// 使用多个Workers时批次之间的处理顺序是不确定的，如果要记录处理进度用于After，需要记录所有已完成批次中连续的最大主键。
+func (t *Table) ChunkByID(size int, f func(rows RowsMap) error, opts ...ChunkOption) error {
+	var opt ChunkOption
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
+	if size <= 0 {
+		return ErrArgs
+	}
+	c, err := t.chunker(opt.Key)
+	if err != nil {
+		return err
+	}
+	maxKey := c.base.Clone().Max(c.key)
+	if maxKey.Err() != nil {
+		return maxKey.Err()
+	}
+	if maxKey.IsNull() {
+		return nil
+	}
+	maxVal := c.value(maxKey.String())
+
+	var (
+		ch      chan RowsMap
+		done    chan struct{}
+		wg      sync.WaitGroup
+		once    sync.Once
+		errOnce error
+	)
+	fail := func(err error) {
+		once.Do(func() {
+			errOnce = err
+			close(done)
+		})
+	}
+	if opt.Workers > 1 {
+		ch = make(chan RowsMap)
+		done = make(chan struct{})
+		for i := 0; i < opt.Workers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for rows := range ch {
+					select {
+					case <-done:
+						continue
+					default:
+					}
+					if err := f(rows); err != nil {
+						fail(err)
+					}
+				}
+			}()
+		}
+	}
+
+	last := opt.After
+loop:
+	for {
+		query, args := c.page(last, maxVal, size).Parse()
+		rows := c.base.queryRows(query, args...)
+		if rows.err != nil {
+			err = rows.err
+			break
+		}
+		data := rows.RowsMap()
+		if len(data) == 0 {
+			break
+		}
+		last = c.value(data[len(data)-1][c.column])
+		if ch == nil {
+			if err = f(data); err != nil {
+				break
+			}
+		} else {
+			select {
+			case ch <- data:
+			case <-done:
+				break loop
+			}
+		}
+		if len(data) < size {
+			break
+		}
+	}
+	if ch != nil {
+		close(ch)
+		wg.Wait()
+		if err == nil {
+			err = errOnce
+		}
+	}
+	if err == ErrBreak {
+		return nil
+	}
+	return err
+}
+
+// chunker ChunkByID的查询
+type chunker struct {
+	base   *Search
+	key    string // 带表名的主键，用于SQL中
+	column string // 主键的列名，用于RowMap中
+	col    Column // 主键的列，用于把RowMap中的值转换成对应的类型
+}
+
+// chunker 使用当前的条件和key生成chunker，key为空时使用表结构中的主键。
+func (t *Table) chunker(key string) (*chunker, error) {
+	if key == "" {
+		pks := t.primaryKeys()
+		if len(pks) > 1 {
+			return nil, fmt.Errorf("%w: 联合主键%s需要在ChunkOption中指定Key", ErrArgs, strings.Join(pks, ","))
+		}
+		key = pks[0]
+	}
+	c := &chunker{column: strings.Trim(key[strings.LastIndex(key, ".")+1:], "`")}
+	tableName := t.tableName
+	if i := strings.LastIndex(key, "."); i > 0 {
+		tableName = strings.Trim(key[:i], "`")
+	}
+	c.col = t.DataBase.tableColumns[tableName][c.column]
+	base := t.Search.Clone()
+	base.orderbyConditions = nil
+	base.limit = nil
+	base.offset = nil
+	if len(base.groupConditions) > 0 || len(base.havingConditions) > 0 {
+		// 分组之后的结果作为子查询，主键是子查询中的列
+		query, args := base.Parse()
+		sub := &Search{table: base.table, tableName: t.tableName, err: base.err}
+		c.base = sub.Raw(query, args...)
+		c.key = "`" + t.tableName + "`.`" + c.column + "`"
+		return c, nil
+	}
+	// 条件中可能有OR，加上括号之后再和主键的条件AND
+	for i, w := range base.whereConditions {
+		base.whereConditions[i].Query = "(" + w.Query + ")"
+	}
+	if len(base.fields) > 0 {
+		base.fields = append(base.fields, key)
+	}
+	c.base = base
+	c.key = key
+	if !strings.ContainsAny(key, ".`") {
+		c.key = "`" + t.tableName + "`.`" + key + "`"
+	}
+	return c, nil
+}
+
+// page last之后的一批数据，last为nil的时候从头开始。
+func (c *chunker) page(last, maxVal interface{}, size int) *Search {
+	s := c.base.Clone()
+	if last != nil {
+		s.Where(c.key+" > ?", last)
+	}
+	return s.Where(c.key+" <= ?", maxVal).OrderBy(c.key).Limit(size)
+}
+
+// value 将主键的字符串值转换成列对应的类型，整数的主键使用整数比较，其他的使用字符串比较。
+func (c *chunker) value(raw string) interface{} {
+	switch strings.ToLower(c.col.DataType) {
+	case "tinyint", "smallint", "mediumint", "int", "integer", "bigint":
+		if strings.Contains(strings.ToLower(c.col.ColumnType), "unsigned") {
+			if u, err := strconv.ParseUint(raw, 10, 64); err == nil {
+				return u
+			}
+		}
+		if i, err := strconv.ParseInt(raw, 10, 64); err == nil {
+			return i
+		}
+	case "":
+		// 不知道表结构的时候，数字按照整数处理
+		if i, err := strconv.ParseInt(raw, 10, 64); err == nil {
+			return i
+		}
+	}
+	return raw
+}
@@ -0,0 +1,150 @@
+package crud
+
+import (
+	"database/sql/driver"
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func newChunkDataBase(tables map[string][]string, db *DataBase) *DataBase {
+	if db == nil {
+		db = newTestDataBase(tables)
+	}
+	id := db.tableColumns["order"]["id"]
+	id.Key, id.DataType, id.ColumnType = "PRI", "bigint", "bigint(20) unsigned"
+	db.tableColumns["order"]["id"] = id
+	return db
+}
+
+func TestChunker(t *testing.T) {
+	db := newChunkDataBase(map[string][]string{"order": {"id", "user_id", "status", "is_deleted"}}, nil)
+
+	c, err := db.Table("order").Where("status = ? OR user_id = ?", 1, 2).OrderBy("user_id").Limit(5).chunker("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	query, args := c.page(nil, uint64(10), 100).Parse()
+	want := "SELECT * FROM `order` WHERE (status = ? OR user_id = ?) AND `order`.`id` <= ? AND is_deleted = ? ORDER BY `order`.`id` ASC LIMIT ?"
+	if query != want || !reflect.DeepEqual(args, []interface{}{1, 2, uint64(10), 0, 100}) {
+		t.Fatalf("page() = %s %v, want %s", query, args, want)
+	}
+	query, args = c.page(uint64(5), uint64(10), 100).Parse()
+	want = "SELECT * FROM `order` WHERE (status = ? OR user_id = ?) AND `order`.`id` > ? AND `order`.`id` <= ? AND is_deleted = ? ORDER BY `order`.`id` ASC LIMIT ?"
+	if query != want || !reflect.DeepEqual(args, []interface{}{1, 2, uint64(5), uint64(10), 0, 100}) {
+		t.Fatalf("page() after 5 = %s %v, want %s", query, args, want)
+	}
+	if v := c.value("18446744073709551615"); v != uint64(18446744073709551615) {
+		t.Fatalf("value() = %#v, want uint64", v)
+	}
+
+	c, err = db.Table("order").Fields("user_id", "COUNT(*) AS n").Group("user_id").Having("n > ?", 1).chunker("user_id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	query, args = c.page(int64(3), int64(9), 10).Parse()
+	want = "SELECT * FROM (SELECT `order`.`user_id`,COUNT(*) AS n FROM `order` WHERE is_deleted = ? GROUP BY user_id HAVING n > ?) AS `order` WHERE `order`.`user_id` > ? AND `order`.`user_id` <= ? ORDER BY `order`.`user_id` ASC LIMIT ?"
+	if query != want || !reflect.DeepEqual(args, []interface{}{0, 1, int64(3), int64(9), 10}) {
+		t.Fatalf("grouped page() = %s %v, want %s", query, args, want)
+	}
+	if v := c.value("7"); v != int64(7) {
+		t.Fatalf("value() of an unknown column = %#v, want int64", v)
+	}
+
+	db = newTestDataBase(map[string][]string{"order_item": {"order_id", "sku", "qty"}})
+	for _, name := range []string{"order_id", "sku"} {
+		col := db.tableColumns["order_item"][name]
+		col.Key, col.DataType = "PRI", "varchar"
+		db.tableColumns["order_item"][name] = col
+	}
+	if _, err := db.Table("order_item").chunker(""); !errors.Is(err, ErrArgs) {
+		t.Fatalf("chunker() with a composite key = %v, want %v", err, ErrArgs)
+	}
+	c, err = db.Table("order_item").chunker("sku")
+	if err != nil || c.key != "`order_item`.`sku`" || c.value("007") != "007" {
+		t.Fatalf("chunker(sku) = %v %v", c, err)
+	}
+}
+
+func TestChunkByID(t *testing.T) {
+	fake, fdb := newFakeDataBase(t, map[string][]string{"order": {"id", "status"}})
+	db := newChunkDataBase(nil, fake)
+	fdb.query = func(query string, args []driver.Value) (*fakeRows, error) {
+		if strings.HasPrefix(query, "SELECT MAX(") {
+			return newFakeRows([]string{"agg"}, []driver.Value{int64(7)}), nil
+		}
+		var last int64
+		if strings.Contains(query, "> ?") {
+			last, args = args[0].(int64), args[1:]
+		}
+		maxVal, limit := args[0].(int64), args[1].(int64)
+		rows := newFakeRows([]string{"id", "status"})
+		for id := last + 1; id <= maxVal && int64(len(rows.vals)) < limit; id++ {
+			rows.vals = append(rows.vals, []driver.Value{int64(id), int64(1)})
+		}
+		return rows, nil
+	}
+	collect := func(opt ChunkOption, stop func(batch []string) error) ([][]string, error) {
+		var (
+			mu      sync.Mutex
+			batches [][]string
+		)
+		err := db.Table("order").ChunkByID(3, func(rows RowsMap) error {
+			batch := []string{}
+			for _, r := range rows {
+				batch = append(batch, r["id"])
+			}
+			mu.Lock()
+			batches = append(batches, batch)
+			mu.Unlock()
+			if stop != nil {
+				return stop(batch)
+			}
+			return nil
+		}, opt)
+		return batches, err
+	}
+
+	batches, err := collect(ChunkOption{}, nil)
+	want := [][]string{{"1", "2", "3"}, {"4", "5", "6"}, {"7"}}
+	if err != nil || !reflect.DeepEqual(batches, want) {
+		t.Fatalf("ChunkByID() = %v %v, want %v", batches, err, want)
+	}
+
+	batches, err = collect(ChunkOption{After: uint64(4)}, nil)
+	if err != nil || !reflect.DeepEqual(batches, [][]string{{"5", "6", "7"}}) {
+		t.Fatalf("ChunkByID() after 4 = %v %v", batches, err)
+	}
+
+	batches, err = collect(ChunkOption{}, func([]string) error { return ErrBreak })
+	if err != nil || len(batches) != 1 {
+		t.Fatalf("ChunkByID() with ErrBreak = %v %v", batches, err)
+	}
+
+	batches, err = collect(ChunkOption{Workers: 3}, nil)
+	ids := []string{}
+	for _, b := range batches {
+		ids = append(ids, b...)
+	}
+	sort.Strings(ids)
+	if err != nil || len(batches) != 3 || !reflect.DeepEqual(ids, []string{"1", "2", "3", "4", "5", "6", "7"}) {
+		t.Fatalf("ChunkByID() with workers = %v %v", batches, err)
+	}
+
+	errFix := errors.New("fix failed")
+	_, err = collect(ChunkOption{Workers: 2}, func(batch []string) error {
+		if batch[0] == "4" {
+			return errFix
+		}
+		return nil
+	})
+	if err != errFix {
+		t.Fatalf("ChunkByID() with a failing worker = %v, want %v", err, errFix)
+	}
+	if fdb.openRows() != 0 {
+		t.Fatalf("ChunkByID() left %d rows open", fdb.openRows())
+	}
+}
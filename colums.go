@@ -1,5 +1,10 @@
 package crud
 
+import (
+	"sort"
+	"strings"
+)
+
 // Columns 用于表示一张表中的列，使用名字作为index，方便查找。
 type Columns map[string]Column
 
@@ -21,4 +26,48 @@ type Column struct {
 	ColumnType string //列类型 tinyint(3) unsigned
 	DataType   string //数据类型 tinyint
 	IsNullAble bool   //是否可为NULL
+	Key        string //索引 PRI、UNI、MUL
+	Extra      string //额外信息 auto_increment
+	Position   int    //列的顺序，从1开始
+}
+
+// IsPrimaryKey 是否是主键
+func (c Column) IsPrimaryKey() bool {
+	return c.Key == "PRI"
+}
+
+// IsAutoIncrement 是否是自增列
+func (c Column) IsAutoIncrement() bool {
+	return strings.Contains(strings.ToLower(c.Extra), "auto_increment")
+}
+
+// PrimaryKeys 主键的列名，联合主键按照列的顺序返回，没有主键时为空。
+func (cs Columns) PrimaryKeys() []string {
+	pks := []Column{}
+	for _, c := range cs {
+		if c.IsPrimaryKey() {
+			pks = append(pks, c)
+		}
+	}
+	sort.Slice(pks, func(i, j int) bool {
+		if pks[i].Position != pks[j].Position {
+			return pks[i].Position < pks[j].Position
+		}
+		return pks[i].Name < pks[j].Name
+	})
+	names := make([]string, len(pks))
+	for i, c := range pks {
+		names[i] = c.Name
+	}
+	return names
+}
+
+// AutoIncrement 自增列的列名，没有时为""
+func (cs Columns) AutoIncrement() string {
+	for _, c := range cs {
+		if c.IsAutoIncrement() {
+			return c.Name
+		}
+	}
+	return ""
 }
@@ -0,0 +1,226 @@
+package crud
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+var (
+	timeType    = reflect.TypeOf(time.Time{})
+	scannerType = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+
+	// timeLayouts 字符串转换成time.Time时依次尝试的格式，TimeFormat会最先尝试。
+	timeLayouts = []string{"2006-01-02 15:04:05.999999", "2006-01-02", time.RFC3339Nano}
+)
+
+// scanValues 扫描一行数据，NULL为nil，其他为驱动返回的原始类型([]byte、int64、float64、time.Time等)。
+func scanValues(rows *sql.Rows, n int) ([]interface{}, error) {
+	vals := make([]interface{}, n)
+	dest := make([]interface{}, n)
+	for i := range vals {
+		dest[i] = &vals[i]
+	}
+	if err := rows.Scan(dest...); err != nil {
+		return nil, err
+	}
+	return vals, nil
+}
+
+// isStructRow 结构体按照字段赋值，time.Time以及实现了sql.Scanner的结构体当作单个值处理。
+func isStructRow(t reflect.Type) bool {
+	return t.Kind() == reflect.Struct && t != timeType && !reflect.PtrTo(t).Implements(scannerType)
+}
+
+// setRow 将一行数据放到v中，v为结构体时按列名赋值，否则使用第一列。
+func setRow(v reflect.Value, cols []string, vals []interface{}) error {
+	if !isStructRow(v.Type()) {
+		if len(vals) == 0 {
+			return nil
+		}
+		return assignValue(v, vals[0])
+	}
+	ms := getModel(v.Type())
+	for i, col := range cols {
+		f, ok := ms.byColumn[col]
+		if !ok {
+			continue
+		}
+		if err := assignValue(v.FieldByIndex(f.index), vals[i]); err != nil {
+			return fmt.Errorf("字段%s(%s)转换失败: %w", f.name, col, err)
+		}
+	}
+	ms.takeSnapshot(v)
+	return nil
+}
+
+// assignValue 将数据库中的值转换后赋值给dst
+func assignValue(dst reflect.Value, src interface{}) error {
+	if !dst.CanSet() {
+		return nil
+	}
+	if dst.CanAddr() && dst.Addr().Type().Implements(scannerType) {
+		return dst.Addr().Interface().(sql.Scanner).Scan(src)
+	}
+	if src == nil {
+		dst.Set(reflect.Zero(dst.Type()))
+		return nil
+	}
+	if dst.Kind() == reflect.Ptr {
+		nv := reflect.New(dst.Type().Elem())
+		if err := assignValue(nv.Elem(), src); err != nil {
+			return err
+		}
+		dst.Set(nv)
+		return nil
+	}
+	if dst.Type() == timeType {
+		t, err := toTime(src)
+		if err != nil {
+			return err
+		}
+		dst.Set(reflect.ValueOf(t))
+		return nil
+	}
+	switch dst.Kind() {
+	case reflect.String:
+		dst.SetString(asString(src))
+	case reflect.Bool:
+		b, err := toBool(src)
+		if err != nil {
+			return err
+		}
+		dst.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var i int64
+		switch src := src.(type) {
+		case int64:
+			i = src
+		case float64:
+			i = int64(src)
+			if float64(i) != src {
+				return fmt.Errorf("%w: %v不是整数", ErrNotSupportType, src)
+			}
+		default:
+			var err error
+			i, err = strconv.ParseInt(asString(src), 10, dst.Type().Bits())
+			if err != nil {
+				return err
+			}
+		}
+		if dst.OverflowInt(i) {
+			return fmt.Errorf("%w: %d超出%s的范围", ErrNotSupportType, i, dst.Type())
+		}
+		dst.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		var u uint64
+		switch src := src.(type) {
+		case int64:
+			if src < 0 {
+				return fmt.Errorf("%w: %d不能转换成%s", ErrNotSupportType, src, dst.Type())
+			}
+			u = uint64(src)
+		default:
+			var err error
+			u, err = strconv.ParseUint(asString(src), 10, dst.Type().Bits())
+			if err != nil {
+				return err
+			}
+		}
+		if dst.OverflowUint(u) {
+			return fmt.Errorf("%w: %d超出%s的范围", ErrNotSupportType, u, dst.Type())
+		}
+		dst.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		var f float64
+		switch src := src.(type) {
+		case float64:
+			f = src
+		case int64:
+			f = float64(src)
+		default:
+			var err error
+			f, err = strconv.ParseFloat(asString(src), dst.Type().Bits())
+			if err != nil {
+				return err
+			}
+		}
+		dst.SetFloat(f)
+	case reflect.Slice:
+		if dst.Type().Elem().Kind() != reflect.Uint8 {
+			return fmt.Errorf("%w: %s", ErrNotSupportType, dst.Type())
+		}
+		var b []byte
+		switch src := src.(type) {
+		case []byte:
+			b = append([]byte(nil), src...)
+		default:
+			b = []byte(asString(src))
+		}
+		dst.SetBytes(b)
+	case reflect.Interface:
+		dst.Set(reflect.ValueOf(src))
+	default:
+		sv := reflect.ValueOf(src)
+		if !sv.Type().ConvertibleTo(dst.Type()) {
+			return fmt.Errorf("%w: %T不能转换成%s", ErrNotSupportType, src, dst.Type())
+		}
+		dst.Set(sv.Convert(dst.Type()))
+	}
+	return nil
+}
+
+func asString(src interface{}) string {
+	switch v := src.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case time.Time:
+		return v.Format(TimeFormat)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return fmt.Sprintf("%v", src)
+}
+
+func toBool(src interface{}) (bool, error) {
+	switch v := src.(type) {
+	case bool:
+		return v, nil
+	case int64:
+		return v != 0, nil
+	case []byte:
+		// bit(1)返回的是\x00和\x01
+		if len(v) == 1 && v[0] <= 1 {
+			return v[0] == 1, nil
+		}
+	}
+	return strconv.ParseBool(asString(src))
+}
+
+// toTime 将数据库中的时间转换成time.Time，0000-00-00这种零值会转换成time.Time{}。
+func toTime(src interface{}) (time.Time, error) {
+	if t, ok := src.(time.Time); ok {
+		return t, nil
+	}
+	s := asString(src)
+	if s == "" || s[0] == '0' && (s == "0000-00-00" || s == "0000-00-00 00:00:00") {
+		return time.Time{}, nil
+	}
+	t, err := time.ParseInLocation(TimeFormat, s, time.Local)
+	if err == nil {
+		return t, nil
+	}
+	for _, layout := range timeLayouts {
+		t, err = time.ParseInLocation(layout, s, time.Local)
+		if err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, err
+}
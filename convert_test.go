@@ -0,0 +1,47 @@
+package crud
+
+import (
+	"database/sql"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSetRow(t *testing.T) {
+	type user struct {
+		ID        int64
+		Age       uint8
+		Score     float32
+		Name      string
+		Nick      *string
+		Avatar    []byte
+		IsAdmin   bool
+		CreatedAt time.Time
+		DeletedAt *time.Time
+		Remark    sql.NullString
+		Level     int `dbname:"lv"`
+	}
+	cols := []string{"id", "age", "score", "name", "nick", "avatar", "is_admin", "created_at", "deleted_at", "remark", "lv"}
+	vals := []interface{}{int64(1), []byte("18"), []byte("9.5"), []byte("tom"), nil, []byte{1, 2}, []byte{1}, []byte("2021-02-20 10:00:00"), nil, []byte("hi"), []byte("3")}
+	var u user
+	if err := setRow(reflect.ValueOf(&u).Elem(), cols, vals); err != nil {
+		t.Fatal(err)
+	}
+	created, _ := time.ParseInLocation(TimeFormat, "2021-02-20 10:00:00", time.Local)
+	want := user{ID: 1, Age: 18, Score: 9.5, Name: "tom", Avatar: []byte{1, 2}, IsAdmin: true, CreatedAt: created, Remark: sql.NullString{String: "hi", Valid: true}, Level: 3}
+	if !reflect.DeepEqual(u, want) {
+		t.Fatalf("setRow() = %+v, want %+v", u, want)
+	}
+
+	if err := setRow(reflect.ValueOf(&u).Elem(), []string{"age"}, []interface{}{[]byte("300")}); err == nil {
+		t.Fatal("setRow() want overflow error")
+	}
+	if err := setRow(reflect.ValueOf(&u).Elem(), []string{"id"}, []interface{}{[]byte("abc")}); err == nil {
+		t.Fatal("setRow() want parse error")
+	}
+
+	var count int
+	if err := setRow(reflect.ValueOf(&count).Elem(), []string{"COUNT(1)"}, []interface{}{int64(5)}); err != nil || count != 5 {
+		t.Fatalf("setRow() count = %d, err = %v", count, err)
+	}
+}
@@ -1,6 +1,7 @@
 package crud
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
@@ -10,6 +11,7 @@ import (
 	"runtime"
 	"strings"
 	"sync"
+	"sync/atomic"
 
 	_ "github.com/go-sql-driver/mysql" //mysql driver
 )
@@ -31,6 +33,10 @@ var (
 	ErrMustBeSlice    = errors.New("必须为Slice")
 	ErrMustNeedID     = errors.New("必须要有ID")
 	ErrNotSupportType = errors.New("不支持类型")
+	ErrNotFound       = errors.New("没有找到记录")
+	ErrBreak          = errors.New("中断遍历")
+	ErrTreeCycle      = errors.New("树中存在环")
+	ErrStaleObject    = errors.New("数据已被修改或删除")
 )
 
 // Render 用于对接http.HandleFunc直接调用CRUD
@@ -40,10 +46,20 @@ type Render func(w http.ResponseWriter, err error, data ...interface{})
 type DataBase struct {
 	debug bool
 
+	versionColumn string // 乐观锁的版本号列，为空时不使用乐观锁
+	batchSize     int    // 批量插入时每条INSERT语句最多的行数
+	increment     *int64 // @@auto_increment_increment的缓存，clone出来的DataBase共用
+
 	Schema         string //数据库表名
 	tableColumns   map[string]Columns
 	dataSourceName string
 	db             *sql.DB
+	tx             *sql.Tx         // 事务，见Begin
+	txDone         *txCallbacks    // 事务结束之后执行的函数
+	ctx            context.Context // 执行SQL时使用的context，见WithContext
+	hooks          map[string][]HookFunc
+	associations   map[string]bool // FindAll时查询的关联，nil时查询所有声明的关联，见Associations
+	preloads       []string        // Find时批量查询的关联，见Preload
 
 	mm *sync.Mutex // 用于getColumns的写锁
 
@@ -64,6 +80,8 @@ func NewDataBase(dataSourceName string, render ...Render) (*DataBase, error) {
 		dataSourceName: dataSourceName,
 		db:             db,
 		mm:             new(sync.Mutex),
+		increment:      new(int64),
+		hooks:          make(map[string][]HookFunc),
 		render: func(w http.ResponseWriter, err error, data ...interface{}) {
 			if len(render) == 1 {
 				if render[0] != nil {
@@ -77,7 +95,7 @@ func NewDataBase(dataSourceName string, render ...Render) (*DataBase, error) {
 	if crud.Schema == "" {
 		log.Println("FBI WARNING: 这是一个没有选择数据库的链接。")
 	}
-	tables := crud.Query("SELECT TABLE_SCHEMA,TABLE_NAME,COLUMN_NAME,COLUMN_COMMENT,COLUMN_TYPE,DATA_TYPE,IS_NULLABLE FROM information_schema.`COLUMNS` WHERE TABLE_SCHEMA = ?", crud.Schema).RowsMap().MapIndexs("TABLE_NAME")
+	tables := crud.Query("SELECT TABLE_SCHEMA,TABLE_NAME,COLUMN_NAME,COLUMN_COMMENT,COLUMN_TYPE,DATA_TYPE,IS_NULLABLE,COLUMN_KEY,EXTRA,ORDINAL_POSITION FROM information_schema.`COLUMNS` WHERE TABLE_SCHEMA = ?", crud.Schema).RowsMap().MapIndexs("TABLE_NAME")
 
 	for tableName, cols := range tables {
 		cm := make(map[string]Column)
@@ -90,6 +108,9 @@ func NewDataBase(dataSourceName string, render ...Render) (*DataBase, error) {
 				ColumnType: v["COLUMN_TYPE"],
 				DataType:   v["DATA_TYPE"],
 				IsNullAble: v["IS_NULLABLE"] == "YES",
+				Key:        v["COLUMN_KEY"],
+				Extra:      v["EXTRA"],
+				Position:   v.Int("ORDINAL_POSITION"),
 			}
 		}
 		crud.tableColumns[tableName] = cm
@@ -139,7 +160,7 @@ func (db *DataBase) getColumns(tableName string) Columns {
 	if ok {
 		return names
 	}
-	rows := db.Query("SELECT COLUMN_NAME,COLUMN_COMMENT,COLUMN_TYPE,DATA_TYPE,IS_NULLABLE FROM information_schema.`COLUMNS` WHERE table_name= ? ", tableName).RowsMap()
+	rows := db.Query("SELECT COLUMN_NAME,COLUMN_COMMENT,COLUMN_TYPE,DATA_TYPE,IS_NULLABLE,COLUMN_KEY,EXTRA,ORDINAL_POSITION FROM information_schema.`COLUMNS` WHERE table_name= ? ", tableName).RowsMap()
 	cols := make(map[string]Column)
 	for _, v := range rows {
 		cols[v["COLUMN_NAME"]] = Column{
@@ -148,6 +169,9 @@ func (db *DataBase) getColumns(tableName string) Columns {
 			ColumnType: v["COLUMN_TYPE"],
 			DataType:   v["DATA_TYPE"],
 			IsNullAble: v["IS_NULLABLE"] == "YES",
+			Key:        v["COLUMN_KEY"],
+			Extra:      v["EXTRA"],
+			Position:   v.Int("ORDINAL_POSITION"),
 		}
 		dbcM.Lock()
 		DBColums[v["COLUMN_NAME"]] = cols[v["COLUMN_NAME"]]
@@ -185,6 +209,52 @@ func (db *DataBase) Debug(isDebug bool) *DataBase {
 	return db
 }
 
+// OptimisticLock 开启乐观锁，column为版本号的列名，不传的时候为Version，为""时关闭。
+// 开启后有这一列的表在Update的时候会加上AND version = ?并且将version加1，
+// 没有更新到任何行的时候返回ErrStaleObject，DataBase.Update成功后会将结构体中的版本号加1。
+func (db *DataBase) OptimisticLock(column ...string) *DataBase {
+	db.versionColumn = Version
+	if len(column) > 0 {
+		db.versionColumn = column[0]
+	}
+	return db
+}
+
+// DefaultBatchSize 默认的批量插入时每条INSERT语句最多的行数
+const DefaultBatchSize = 1000
+
+// BatchSize 设置批量插入(Creates)时每条INSERT语句最多的行数，小于等于0时使用DefaultBatchSize。
+// 不管设置多少，每条语句的占位符都不会超过65535个。
+func (db *DataBase) BatchSize(size int) *DataBase {
+	db.batchSize = size
+	return db
+}
+
+func (db *DataBase) getBatchSize() int {
+	if db.batchSize <= 0 {
+		return DefaultBatchSize
+	}
+	return db.batchSize
+}
+
+// autoIncrementIncrement 自增的步长@@auto_increment_increment，在INSERT所在的链接(事务)中查询，
+// 查询成功后缓存在DataBase中，查询失败的时候为1。
+func (db *DataBase) autoIncrementIncrement() int64 {
+	if db.increment != nil {
+		if n := atomic.LoadInt64(db.increment); n > 0 {
+			return n
+		}
+	}
+	n := int64(db.Query("SELECT @@auto_increment_increment").Int())
+	if n <= 0 {
+		return 1
+	}
+	if db.increment != nil {
+		atomic.StoreInt64(db.increment, n)
+	}
+	return n
+}
+
 // X 用于DEBUG
 func (*DataBase) X(args ...interface{}) {
 	fmt.Println("[DEBUG]", args)
@@ -232,9 +302,15 @@ func (db *DataBase) RowSQL(sql string, args ...interface{}) *SQLRows {
 */
 
 // Query 用于底层查询，一般是SELECT语句
+// 如果只传入一个map或者结构体参数，则使用:name/@name命名参数，详见Named。
 func (db *DataBase) Query(sql string, args ...interface{}) *SQLRows {
+	sql, args, err := namedArgs(sql, args)
+	if err != nil {
+		db.stack(err, sql)
+		return &SQLRows{err: err}
+	}
 	db.LogSQL(sql, args...)
-	rows, err := db.DB().Query(sql, args...)
+	rows, err := db.conn().QueryContext(db.Context(), sql, args...)
 
 	if err != nil {
 		db.stack(err, sql, args...)
@@ -243,70 +319,90 @@ func (db *DataBase) Query(sql string, args ...interface{}) *SQLRows {
 }
 
 // Exec 用于底层执行，一般是INSERT INTO、DELETE、UPDATE。
+// 如果只传入一个map或者结构体参数，则使用:name/@name命名参数，详见Named。
+// 执行出错的时候返回的sql.Result的LastInsertId和RowsAffected都会返回这个错误。
 func (db *DataBase) Exec(sql string, args ...interface{}) sql.Result {
+	sql, args, err := namedArgs(sql, args)
+	if err != nil {
+		db.stack(err, sql)
+		return errResult{err: err}
+	}
 	db.LogSQL(sql, args...)
-	ret, err := db.DB().Exec(sql, args...)
+	ret, err := db.conn().ExecContext(db.Context(), sql, args...)
 	if err != nil {
 		db.stack(err, sql, args...)
+		return errResult{err: err}
 	}
 	return ret
 }
 
+// errResult 执行出错时返回的sql.Result
+type errResult struct {
+	err error
+}
+
+func (r errResult) LastInsertId() (int64, error) {
+	return 0, r.err
+}
+
+func (r errResult) RowsAffected() (int64, error) {
+	return 0, r.err
+}
+
 // DB 返回一个DB链接，查询后一定要关闭col，而不能关闭*sql.DB。
 func (db *DataBase) DB() *sql.DB {
 	return db.db
 }
 
 // Create 根据相应单个结构体进行创建
+// 创建和钩子函数在同一个事务中执行，钩子返回error的时候会回滚，没有钩子和关联的时候不会开启事务。
+// 结构体中声明了关联的时候会在同一个事务中级联保存关联的结构体，见save.go。
 func (db *DataBase) Create(obj interface{}) (int64, error) {
 	//一定要是地址
 	//需要检查Before函数
 	//需要按需转换成map(考虑ignore)
 	//需要检查After函数
-	//TODO 一次性创建整个嵌套结构体
 	v := reflect.ValueOf(obj)
 	if v.Kind() != reflect.Ptr {
 		return 0, ErrMustBeAddr
 	}
-	beforeFunc := v.MethodByName(BeforeCreate)
-	afterFunc := v.MethodByName(AfterCreate)
-	tableName := getStructDBName(v)
+	s := newSaver(true)
+	var id int64
+	err := db.transaction(s.needTx(db, v, BeforeCreate, AfterCreate), func(tx *DataBase) error {
+		var err error
+		id, err = s.create(tx, v)
+		return err
+	})
+	s.finish(db, err)
+	return id, err
+}
 
-	// 这里的处理应该是有才处理，没有不管。
-	if beforeFunc.IsValid() {
-		vals := beforeFunc.Call(nil)
-		if len(vals) == 1 {
-			if err, ok := vals[0].Interface().(error); ok {
-				if err != nil {
-					return 0, err
-				}
-			}
-		}
-	}
-	m := structToMap(v)
-	table := db.Table(tableName)
+// createMap 结构体(指针)创建时写入的列，以及创建后需要回填的自增主键字段(不需要回填的时候无效)。
+func createMap(v reflect.Value, table *Table) (map[string]interface{}, reflect.Value) {
+	ms := getModel(v.Type())
+	m := ms.toMap(v, true, true)
 	for k, v := range m {
-		if k == "id" && v == "" {
-			delete(m, "id")
-		}
 		if table.Columns[k].DataType == "datetime" && v == "" {
 			delete(m, k)
 		}
 	}
-	id, err := table.Create(m)
-
-	rID := v.Elem().FieldByName("ID")
-	if rID.IsValid() {
-		rID.SetInt(id)
+	_, autoIncr := ms.primaryKeys(table.Columns)
+	if autoIncr == nil {
+		return m, reflect.Value{}
 	}
-
-	if afterFunc.IsValid() {
-		afterFunc.Call(nil)
+	autoField := v.Elem().FieldByIndex(autoIncr.index)
+	if !isBlank(autoField) {
+		// 手动指定了自增主键的值就不用回填
+		return m, reflect.Value{}
 	}
-	return id, err
+	delete(m, autoIncr.column)
+	return m, autoField
 }
 
-// Creates 根据相应多个结构体进行创建
+// Creates 根据相应多个结构体进行创建，objs为*[]T或者*[]*T。
+// 会在一个事务中使用多行的INSERT语句批量创建，每个结构体都会调用BeforeCreate、AfterCreate。
+// 一批中所有的自增主键都是零值的时候会按照LastInsertId和@@auto_increment_increment回填自增主键，
+// 这需要innodb_autoinc_lock_mode不为2(interleaved)，返回的ids中没有回填的为0。
 func (db *DataBase) Creates(objs interface{}) ([]int64, error) {
 	ids := []int64{}
 	v := reflect.ValueOf(objs)
@@ -316,42 +412,139 @@ func (db *DataBase) Creates(objs interface{}) ([]int64, error) {
 	if v.Elem().Kind() != reflect.Slice {
 		return ids, ErrMustBeSlice
 	}
-
-	for i, num := 0, v.Elem().Len(); i < num; i++ {
-		id, err := db.Create(v.Elem().Index(i).Addr().Interface())
-		if err != nil {
-			return ids, err
+	rv := v.Elem()
+	num := rv.Len()
+	if num == 0 {
+		return ids, nil
+	}
+	elemType := rv.Type().Elem()
+	if elemType.Kind() == reflect.Ptr {
+		elemType = elemType.Elem()
+	}
+	table := db.Table(getStructDBName(reflect.New(elemType)))
+	_, autoIncr := getModel(elemType).primaryKeys(table.Columns)
+
+	elems := make([]reflect.Value, num)
+	ms := make([]map[string]interface{}, num)
+	autoFields := make([]reflect.Value, num)
+	ids = make([]int64, num)
+	err := db.Transaction(func(tx *DataBase) error {
+		table := tx.Table(table.tableName)
+		for i := 0; i < num; i++ {
+			elems[i] = rv.Index(i)
+			if elems[i].Kind() != reflect.Ptr {
+				elems[i] = elems[i].Addr()
+			}
+			if err := tx.callHook(elems[i], BeforeCreate); err != nil {
+				return err
+			}
+			ms[i], autoFields[i] = createMap(elems[i], table)
 		}
 
-		ids = append(ids, id)
+		increment := int64(0)
+		_, err := table.creates(ms, func(start, end int, firstID int64) error {
+			generated := firstID > 0
+			for i := start; i < end && generated; i++ {
+				generated = autoIncr == nil || autoFields[i].IsValid()
+			}
+			if generated && increment == 0 {
+				increment = tx.autoIncrementIncrement()
+			}
+			for i := start; i < end; i++ {
+				if generated {
+					ids[i] = firstID + int64(i-start)*increment
+					if autoFields[i].IsValid() {
+						if err := assignValue(autoFields[i], ids[i]); err != nil {
+							return err
+						}
+					}
+				}
+				if err := tx.callHook(elems[i], AfterCreate); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		return err
+	})
+	// 回滚了就不应该有ID
+	rollback := func() {
+		for i, f := range autoFields {
+			if f.IsValid() {
+				f.Set(reflect.Zero(f.Type()))
+			}
+			ids[i] = 0
+		}
 	}
-
+	if err != nil {
+		rollback()
+		return ids, err
+	}
+	// 在调用者的事务中的时候，调用者回滚之后也要清空
+	db.afterTx(nil, rollback)
 	return ids, nil
 }
 
-// Update Update
-func (db *DataBase) Update(obj interface{}) error {
-	//根据ID进行Update
+// Upsert 根据结构体插入或者更新，见Table.Upsert，冲突的时候更新除了主键以外的所有列。
+// 零值的自增主键不会插入，执行成功后会回填为新插入或者已有行的ID。Upsert不会调用钩子函数。
+func (db *DataBase) Upsert(obj interface{}) (UpsertResult, error) {
 	v := reflect.ValueOf(obj)
 	if v.Kind() != reflect.Ptr {
-		return ErrMustBeAddr
+		return UpsertResult{}, ErrMustBeAddr
+	}
+	table := db.Table(getStructDBName(v))
+	ms := getModel(v.Type())
+	m, autoField := createMap(v, table)
+	pks, _ := ms.primaryKeys(table.Columns)
+	isPK := map[string]bool{CreatedAt: true}
+	for _, f := range pks {
+		isPK[f.column] = true
+	}
+	updateColumns := []string{}
+	for _, f := range ms.columns {
+		if _, ok := m[f.column]; ok && !isPK[f.column] {
+			updateColumns = append(updateColumns, f.column)
+		}
 	}
-	beforeFunc := v.MethodByName(BeforeUpdate)
-	afterFunc := v.MethodByName(AfterUpdate)
-	if beforeFunc.IsValid() {
-		beforeFunc.Call(nil)
+	if _, ok := m[UpdatedAt]; !ok && table.Columns.HaveColumn(UpdatedAt) {
+		updateColumns = append(updateColumns, UpdatedAt)
 	}
-	tableName := getStructDBName(v)
-	m := structToMap(v)
-	err := db.Table(tableName).Update(m)
+	ret, err := table.Upsert(m, updateColumns...)
+	if err == nil && autoField.IsValid() && ret.ID > 0 {
+		err = assignValue(autoField, ret.ID)
+	}
+	return ret, err
+}
 
-	if err != nil {
-		return err
+// Update Update
+// 根据主键更新，结构体嵌入了Snapshot并且是查询出来的时候只更新有变化的列，否则更新所有列。
+// 结构体中声明了关联的时候会在同一个事务中级联保存关联的结构体，见save.go。
+func (db *DataBase) Update(obj interface{}) error {
+	return db.update(obj, changedColumns, true)
+}
+
+// changedColumns Update时更新的列，有Snapshot的时候为有变化的列，否则为nil(所有列)。
+func changedColumns(ms *modelStruct, v reflect.Value) ([]string, error) {
+	if cols, tracked := ms.dirtyColumns(v); tracked {
+		return cols, nil
 	}
-	if afterFunc.IsValid() {
-		afterFunc.Call(nil)
+	return nil, nil
+}
+
+// update 根据主键更新columns返回的列，columns返回nil的时候更新所有列，返回空的时候不执行更新。
+// 更新和钩子函数在同一个事务中执行，钩子返回error的时候会回滚，cascade为true时级联保存关联。
+func (db *DataBase) update(obj interface{}, columns func(ms *modelStruct, v reflect.Value) ([]string, error), cascade bool) error {
+	//根据ID进行Update
+	v := reflect.ValueOf(obj)
+	if v.Kind() != reflect.Ptr {
+		return ErrMustBeAddr
 	}
-	return nil
+	s := newSaver(cascade)
+	err := db.transaction(s.needTx(db, v, BeforeUpdate, AfterUpdate), func(tx *DataBase) error {
+		return s.update(tx, v, columns, false)
+	})
+	s.finish(db, err)
+	return err
 }
 
 // Updates Updates
@@ -374,27 +567,33 @@ func (db *DataBase) Updates(objs interface{}) error {
 }
 
 // Delete Delete
+// 删除和钩子函数在同一个事务中执行，钩子返回error的时候会回滚，没有钩子的时候不会开启事务。
 func (db *DataBase) Delete(obj interface{}) (int64, error) {
 	v := reflect.ValueOf(obj)
 	if v.Kind() != reflect.Ptr {
 		return 0, ErrMustBeAddr
 	}
-	beforeFunc := v.MethodByName(BeforeDelete)
-	afterFunc := v.MethodByName(AfterDelete)
-	if beforeFunc.IsValid() {
-		beforeFunc.Call(nil)
-	}
-	id := getStructID(v)
-	if id == 0 {
-		return 0, ErrMustNeedID
-	}
 	tableName := getStructDBName(v)
-
-	count, err := db.Table(tableName).Delete(map[string]interface{}{"id": id})
-	if afterFunc.IsValid() {
-		afterFunc.Call(nil)
+	var count int64
+	err := db.transaction(db.hasHook(v, BeforeDelete, AfterDelete), func(tx *DataBase) error {
+		if err := tx.callHook(v, BeforeDelete); err != nil {
+			return err
+		}
+		table := tx.Table(tableName)
+		pks, _ := getModel(v.Type()).primaryKeys(table.Columns)
+		keys, err := pkMap(v, pks)
+		if err != nil {
+			return err
+		}
+		if count, err = table.Delete(keys); err != nil {
+			return err
+		}
+		return tx.callHook(v, AfterDelete)
+	})
+	if err != nil {
+		return 0, err
 	}
-	return count, err
+	return count, nil
 }
 
 // Deletes Deletes
@@ -488,6 +687,12 @@ func (db *DataBase) FormDelete(v interface{}, w http.ResponseWriter, r *http.Req
 	db.ExecSuccessRender(w)
 }
 
+// isSelectQuery 是否是完整的查询语句，而不是查询条件
+func isSelectQuery(sql string) bool {
+	sql = strings.ToUpper(strings.TrimSpace(sql))
+	return strings.HasPrefix(sql, "SELECT") || strings.HasPrefix(sql, "WITH")
+}
+
 // Find 将查找数据放到结构体里面
 // 如果不传条件则是查找所有人
 // Read Find Select
@@ -508,7 +713,7 @@ func (db *DataBase) Find(obj interface{}, args ...interface{}) error {
 
 	if len(args) > 0 {
 		if sql, ok := args[0].(string); ok {
-			if strings.Contains(sql, "SELECT") {
+			if isSelectQuery(sql) {
 				rawSqlflag = true
 				err := db.Query(sql, args[1:]...).Find(obj)
 				if err != nil {
@@ -519,14 +724,27 @@ func (db *DataBase) Find(obj interface{}, args ...interface{}) error {
 	}
 
 	if !rawSqlflag {
+		elemType := elem.Type()
 		if elem.Kind() == reflect.Slice {
-			tableName = getStructDBName(reflect.New(elem.Type().Elem()))
+			elemType = elemType.Elem()
+			if elemType.Kind() == reflect.Ptr {
+				elemType = elemType.Elem()
+			}
+			tableName = getStructDBName(reflect.New(elemType))
 		} else {
 			tableName = getStructDBName(elem)
 		}
+		pks, _ := getModel(elemType).primaryKeys(db.tableColumns[tableName])
 
 		if len(args) == 1 {
-			where += " AND id = ? "
+			// 只传一个值的时候按照主键查找，联合主键需要传入条件或者在结构体中设置
+			pk := defaultPKDB
+			if len(pks) > 1 {
+				return ErrArgs
+			} else if len(pks) == 1 {
+				pk = pks[0].column
+			}
+			where += " AND `" + pk + "` = ? "
 			args = append(args, args[0])
 		} else if len(args) > 1 {
 			where += "AND " + args[0].(string)
@@ -534,14 +752,13 @@ func (db *DataBase) Find(obj interface{}, args ...interface{}) error {
 			//avoid args[1:]... bounds out of range
 			args = append(args, nil)
 
-			//如果没有传参数，那么参数就在结构体本身。（只支持ID,而且是结构体的时候）
+			//如果没有传参数，那么参数就在结构体本身。（只支持主键,而且是结构体的时候）
 			if elem.Kind() == reflect.Struct {
-				rID := elem.FieldByName("ID")
-				if rID.IsValid() {
-					rIDInt64 := rID.Int()
-					if rIDInt64 != 0 {
-						where += " AND id = ? "
-						args = append(args, rIDInt64)
+				for _, f := range pks {
+					fv := elem.FieldByIndex(f.index)
+					if !isBlank(fv) {
+						where += " AND `" + f.column + "` = ? "
+						args = append(args, fv.Interface())
 					}
 				}
 			}
@@ -560,20 +777,39 @@ func (db *DataBase) Find(obj interface{}, args ...interface{}) error {
 	switch elem.Kind() {
 	case reflect.Slice:
 		for i, num := 0, elem.Len(); i < num; i++ {
-			afterFunc := elem.Index(i).Addr().MethodByName("AfterFind")
-			if !afterFunc.IsValid() {
-				return nil
+			ev := elem.Index(i)
+			if ev.Kind() != reflect.Ptr {
+				ev = ev.Addr()
+			} else if ev.IsNil() {
+				continue
+			}
+			if err := db.callHook(ev, AfterFind); err != nil {
+				return err
 			}
-			afterFunc.Call(nil)
 		}
 	case reflect.Struct:
-		afterFunc := v.MethodByName("AfterFind")
-		if afterFunc.IsValid() {
-			afterFunc.Call(nil)
+		if err := db.callHook(v, AfterFind); err != nil {
+			return err
 		}
 	}
 
-	return nil
+	return db.preload(structValues(elem), db.preloads)
+}
+
+// structValues 结构体或者结构体slice中的结构体，用于批量查询关联。
+func structValues(rv reflect.Value) []reflect.Value {
+	out := []reflect.Value{}
+	switch rv.Kind() {
+	case reflect.Struct:
+		out = append(out, rv)
+	case reflect.Slice:
+		for i := 0; i < rv.Len(); i++ {
+			if ev := reflect.Indirect(rv.Index(i)); ev.Kind() == reflect.Struct {
+				out = append(out, ev)
+			}
+		}
+	}
+	return out
 }
 
 // connection 找出两张表之间的关联
@@ -637,8 +873,12 @@ func (db *DataBase) connection(target string, got reflect.Value) ([]interface{},
 }
 
 // FindAll 在需要的时候将自动查询结构体子结构体
+// 结构体中用crud tag声明了关联的时候批量查询声明的关联(见association.go、Associations和Preload)，
+// 没有声明的时候按照表名和xxx_id的约定逐个查询所有结构体和slice字段。
 func (db *DataBase) FindAll(v interface{}, args ...interface{}) error {
-	if err := db.Find(v, args...); err != nil {
+	ndb := db.clone()
+	ndb.preloads = nil
+	if err := ndb.Find(v, args...); err != nil {
 		return err
 	}
 	//首先查找字段，然后再查找结构体和Slice
@@ -649,19 +889,27 @@ func (db *DataBase) FindAll(v interface{}, args ...interface{}) error {
 	*/
 	rv := reflect.ValueOf(v).Elem()
 	switch rv.Kind() {
-	case reflect.Struct:
-		db.setStructField(rv)
-	case reflect.Slice:
-		for i := 0; i < rv.Len(); i++ {
-			db.setStructField(rv.Index(i))
-		}
+	case reflect.Struct, reflect.Slice:
 	default:
 		return ErrNotSupportType
 	}
+	owners := structValues(rv)
+	if len(owners) == 0 {
+		return nil
+	}
+	ms := getModel(owners[0].Type())
+	if len(ms.relations) > 0 {
+		return ndb.preload(owners, append(db.relationNames(ms), db.preloads...))
+	}
+	for _, owner := range owners {
+		if err := db.setStructField(owner); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-func (db *DataBase) setStructField(rv reflect.Value) {
+func (db *DataBase) setStructField(rv reflect.Value) error {
 	for i := 0; i < rv.NumField(); i++ {
 		if rv.Field(i).Kind() == reflect.Struct {
 			con, ok := db.connection(ToDBName(rv.Field(i).Type().Name()), rv)
@@ -676,4 +924,5 @@ func (db *DataBase) setStructField(rv reflect.Value) {
 			}
 		}
 	}
+	return nil
 }
@@ -0,0 +1,86 @@
+package crud
+
+import (
+	"database/sql/driver"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type BatchUser struct {
+	ID   int
+	Name string
+}
+
+func TestCreates(t *testing.T) {
+	db, fdb := newFakeDataBase(t, map[string][]string{"batch_user": {"id", "name"}})
+	id := db.tableColumns["batch_user"]["id"]
+	id.Key, id.Extra = "PRI", "auto_increment"
+	db.tableColumns["batch_user"]["id"] = id
+	db.BatchSize(2)
+	fdb.query = func(query string, args []driver.Value) (*fakeRows, error) {
+		return newFakeRows([]string{"@@auto_increment_increment"}, []driver.Value{int64(2)}), nil
+	}
+	lastID := int64(0)
+	fdb.exec = func(query string, args []driver.Value) (driver.Result, error) {
+		lastID += 10
+		return fakeResult{id: lastID, affected: int64(len(args))}, nil
+	}
+
+	users := []BatchUser{{Name: "a"}, {Name: "b"}, {Name: "c"}}
+	ids, err := db.Creates(&users)
+	if err != nil || !reflect.DeepEqual(ids, []int64{10, 12, 20}) || users[1].ID != 12 || users[2].ID != 20 {
+		t.Fatalf("Creates() = %v %v, users %v", ids, err, users)
+	}
+	want := []string{
+		"BEGIN",
+		"INSERT INTO `batch_user` (`name`) VALUES (?),(?)",
+		"SELECT @@auto_increment_increment",
+		"INSERT INTO `batch_user` (`name`) VALUES (?)",
+		"COMMIT",
+	}
+	if stmts := fdb.statements(); !reflect.DeepEqual(stmts, want) {
+		t.Fatalf("Creates() SQL = %v, want %v", stmts, want)
+	}
+
+	// 步长缓存在DataBase中，clone出来的DataBase也不会再查询
+	users = []BatchUser{{Name: "d"}}
+	if ids, err = db.Associations().Creates(&users); err != nil || ids[0] != 30 {
+		t.Fatalf("Creates() = %v %v", ids, err)
+	}
+	for _, stmt := range fdb.statements()[len(want):] {
+		if strings.Contains(stmt, "@@auto_increment_increment") {
+			t.Fatalf("Creates() queried the increment again: %v", fdb.statements())
+		}
+	}
+}
+
+type FindUser struct {
+	ID         int
+	IsSelected int
+}
+
+func TestFind(t *testing.T) {
+	db, fdb := newFakeDataBase(t, map[string][]string{"find_user": {"id", "is_selected"}})
+	fdb.query = func(query string, args []driver.Value) (*fakeRows, error) {
+		return newFakeRows([]string{"id", "is_selected"}, []driver.Value{int64(1), int64(1)}), nil
+	}
+	tests := []struct {
+		args []interface{}
+		want string
+	}{
+		{[]interface{}{"is_selected = ?", 1}, "SELECT * FROM `find_user`  WHERE 1 AND is_selected = ?"},
+		{[]interface{}{"select * from find_user where id = ?", 1}, "select * from find_user where id = ?"},
+		{[]interface{}{" WITH t AS (SELECT 1) SELECT * FROM find_user"}, " WITH t AS (SELECT 1) SELECT * FROM find_user"},
+	}
+	for _, tt := range tests {
+		var us []FindUser
+		if err := db.Find(&us, tt.args...); err != nil {
+			t.Fatal(err)
+		}
+		stmts := fdb.statements()
+		if got := stmts[len(stmts)-1]; got != tt.want || !reflect.DeepEqual(us, []FindUser{{1, 1}}) {
+			t.Errorf("Find(%v) = %q %v, want %q", tt.args, got, us, tt.want)
+		}
+	}
+}
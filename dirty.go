@@ -0,0 +1,107 @@
+package crud
+
+import (
+	"reflect"
+)
+
+var snapshotType = reflect.TypeOf(Snapshot{})
+
+// Snapshot 嵌入到结构体中开启脏字段跟踪
+// 通过Find、Next等查询出来的结构体会记录查询时每一列的值，
+// Update的时候只会更新有变化的列，更新成功后会重新记录。没有记录过的结构体Update时更新所有列。
+//
+//	type User struct {
+//		crud.Snapshot
+//		ID   int
+//		Name string
+//	}
+type Snapshot struct {
+	values map[string]interface{} // 列名 => 记录时的值
+}
+
+// takeSnapshot 记录结构体当前每一列的值，结构体没有嵌入Snapshot的时候不处理。
+func (ms *modelStruct) takeSnapshot(v reflect.Value) {
+	v = reflect.Indirect(v)
+	if ms.snapshot == nil || !v.CanAddr() {
+		return
+	}
+	s := v.FieldByIndex(ms.snapshot).Addr().Interface().(*Snapshot)
+	s.values = make(map[string]interface{}, len(ms.columns))
+	for _, f := range ms.columns {
+		s.values[f.column] = snapshotValue(v.FieldByIndex(f.index))
+	}
+}
+
+// dirtyColumns 和记录的值相比有变化的列，没有记录过的时候tracked为false。
+func (ms *modelStruct) dirtyColumns(v reflect.Value) (cols []string, tracked bool) {
+	v = reflect.Indirect(v)
+	if ms.snapshot == nil {
+		return nil, false
+	}
+	s := v.FieldByIndex(ms.snapshot).Interface().(Snapshot)
+	if s.values == nil {
+		return nil, false
+	}
+	cols = []string{}
+	for _, f := range ms.columns {
+		old, ok := s.values[f.column]
+		if !ok || !reflect.DeepEqual(old, snapshotValue(v.FieldByIndex(f.index))) {
+			cols = append(cols, f.column)
+		}
+	}
+	return cols, true
+}
+
+// snapshotValue 用于记录和比较的值，指针记录指向的值，[]byte会复制一份，这样修改原来的值也能发现变化。
+func snapshotValue(fv reflect.Value) interface{} {
+	switch fv.Kind() {
+	case reflect.Ptr:
+		if fv.IsNil() {
+			return nil
+		}
+		return snapshotValue(fv.Elem())
+	case reflect.Slice:
+		if fv.Type().Elem().Kind() == reflect.Uint8 && !fv.IsNil() {
+			return append([]byte{}, fv.Bytes()...)
+		}
+	}
+	return fv.Interface()
+}
+
+// DirtyFields 结构体中有变化的列名，obj需要嵌入Snapshot并且是查询出来的，否则返回nil。
+func DirtyFields(obj interface{}) []string {
+	v := reflect.Indirect(reflect.ValueOf(obj))
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+	cols, _ := getModel(v.Type()).dirtyColumns(v)
+	return cols
+}
+
+// UpdateFields 只更新指定的字段，names可以是字段名或者列名，零值也会被更新，不会保存关联。
+func (db *DataBase) UpdateFields(obj interface{}, names ...string) error {
+	return db.update(obj, func(ms *modelStruct, v reflect.Value) ([]string, error) {
+		cols := make([]string, 0, len(names))
+		for _, name := range names {
+			f, ok := ms.field(name)
+			if !ok {
+				return nil, ErrArgs
+			}
+			cols = append(cols, f.column)
+		}
+		return cols, nil
+	}, false)
+}
+
+// UpdateNonZero 只更新不是零值的字段，不会保存关联。
+func (db *DataBase) UpdateNonZero(obj interface{}) error {
+	return db.update(obj, func(ms *modelStruct, v reflect.Value) ([]string, error) {
+		cols := []string{}
+		for _, f := range ms.columns {
+			if !isBlank(v.FieldByIndex(f.index)) {
+				cols = append(cols, f.column)
+			}
+		}
+		return cols, nil
+	}, false)
+}
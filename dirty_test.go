@@ -0,0 +1,43 @@
+package crud
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDirtyFields(t *testing.T) {
+	type user struct {
+		Snapshot
+		ID     int64
+		Name   string
+		Nick   *string
+		Avatar []byte
+	}
+	ms := getModel(reflect.TypeOf(user{}))
+	if ms.snapshot == nil || len(ms.columns) != 4 {
+		t.Fatalf("getModel() snapshot = %v, columns = %d", ms.snapshot, len(ms.columns))
+	}
+
+	var u user
+	if DirtyFields(&u) != nil {
+		t.Fatal("DirtyFields() should be nil before snapshot")
+	}
+	cols := []string{"id", "name", "nick", "avatar"}
+	vals := []interface{}{int64(1), []byte("tom"), []byte("t"), []byte{1, 2}}
+	if err := setRow(reflect.ValueOf(&u).Elem(), cols, vals); err != nil {
+		t.Fatal(err)
+	}
+	if dirty := DirtyFields(&u); len(dirty) != 0 {
+		t.Fatalf("DirtyFields() = %v, want empty", dirty)
+	}
+	u.Name = ""
+	*u.Nick = "tt"
+	u.Avatar[0] = 9
+	if dirty := DirtyFields(&u); !reflect.DeepEqual(dirty, []string{"name", "nick", "avatar"}) {
+		t.Fatalf("DirtyFields() = %v", dirty)
+	}
+	ms.takeSnapshot(reflect.ValueOf(&u))
+	if dirty := DirtyFields(u); len(dirty) != 0 {
+		t.Fatalf("DirtyFields() after snapshot = %v, want empty", dirty)
+	}
+}
@@ -24,6 +24,10 @@
 // AfterFind
 // BeforeDelete
 // AfterDelete
+// Begin Commit Rollback Transaction
+// RegisterHook
+// 结构体tag db:"column,pk,autoincr,readonly,omitempty" db:"-"
+// 关联 crud:"has_one" crud:"has_many" crud:"belongs_to" crud:"many2many=join_table" Preload 级联保存
 // PLAN:
 // 支持多数据库
 // 支持分表分库
@@ -0,0 +1,201 @@
+package crud
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+)
+
+// 测试用的database/sql驱动，记录执行的SQL并返回预设的结果，不需要连接MySQL。
+
+func init() {
+	sql.Register("crudtest", fakeDriver{})
+}
+
+var (
+	fakeDBs   = map[string]*fakeDB{}
+	fakeDBsMu sync.Mutex
+)
+
+type fakeDB struct {
+	mu    sync.Mutex
+	log   []string         // 执行过的SQL，事务为BEGIN、COMMIT、ROLLBACK
+	args  [][]driver.Value // 和log一一对应
+	open  int              // 没有关闭的rows
+	query func(query string, args []driver.Value) (*fakeRows, error)
+	exec  func(query string, args []driver.Value) (driver.Result, error)
+}
+
+// newFakeDataBase 使用测试驱动的DataBase，tables同newTestDataBase。
+func newFakeDataBase(t *testing.T, tables map[string][]string) (*DataBase, *fakeDB) {
+	fdb := &fakeDB{}
+	fakeDBsMu.Lock()
+	dsn := fmt.Sprintf("%s-%d", t.Name(), len(fakeDBs))
+	fakeDBs[dsn] = fdb
+	fakeDBsMu.Unlock()
+	sqlDB, err := sql.Open("crudtest", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+	db := newTestDataBase(tables)
+	db.db = sqlDB
+	db.hooks = make(map[string][]HookFunc)
+	db.increment = new(int64)
+	return db, fdb
+}
+
+// statements 执行过的SQL
+func (f *fakeDB) statements() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.log...)
+}
+
+// openRows 没有关闭的rows的数量
+func (f *fakeDB) openRows() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.open
+}
+
+func (f *fakeDB) record(query string, args []driver.NamedValue) []driver.Value {
+	vals := make([]driver.Value, len(args))
+	for i, a := range args {
+		vals[i] = a.Value
+	}
+	f.mu.Lock()
+	f.log = append(f.log, query)
+	f.args = append(f.args, vals)
+	f.mu.Unlock()
+	return vals
+}
+
+// fakeRows 预设的查询结果，读完vals之后返回err。
+type fakeRows struct {
+	cols []string
+	vals [][]driver.Value
+	err  error
+
+	db  *fakeDB
+	pos int
+}
+
+func newFakeRows(cols []string, vals ...[]driver.Value) *fakeRows {
+	return &fakeRows{cols: cols, vals: vals}
+}
+
+func (r *fakeRows) Columns() []string {
+	return r.cols
+}
+
+func (r *fakeRows) Close() error {
+	if r.db != nil {
+		r.db.mu.Lock()
+		r.db.open--
+		r.db.mu.Unlock()
+		r.db = nil
+	}
+	return nil
+}
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.pos >= len(r.vals) {
+		if r.err != nil {
+			return r.err
+		}
+		return io.EOF
+	}
+	copy(dest, r.vals[r.pos])
+	r.pos++
+	return nil
+}
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(dsn string) (driver.Conn, error) {
+	fakeDBsMu.Lock()
+	defer fakeDBsMu.Unlock()
+	fdb, ok := fakeDBs[dsn]
+	if !ok {
+		return nil, fmt.Errorf("unknown dsn %s", dsn)
+	}
+	return &fakeConn{db: fdb}, nil
+}
+
+type fakeConn struct {
+	db *fakeDB
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("crudtest: Prepare is not supported")
+}
+
+func (c *fakeConn) Close() error {
+	return nil
+}
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	c.db.record("BEGIN", nil)
+	return fakeTx{c.db}, nil
+}
+
+func (c *fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	vals := c.db.record(query, args)
+	rows := newFakeRows([]string{})
+	if c.db.query != nil {
+		r, err := c.db.query(query, vals)
+		if err != nil {
+			return nil, err
+		}
+		if r != nil {
+			rows = r
+		}
+	}
+	c.db.mu.Lock()
+	c.db.open++
+	c.db.mu.Unlock()
+	rows.db = c.db
+	return rows, nil
+}
+
+func (c *fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	vals := c.db.record(query, args)
+	if c.db.exec != nil {
+		return c.db.exec(query, vals)
+	}
+	return fakeResult{id: 1, affected: 1}, nil
+}
+
+type fakeTx struct {
+	db *fakeDB
+}
+
+func (tx fakeTx) Commit() error {
+	tx.db.record("COMMIT", nil)
+	return nil
+}
+
+func (tx fakeTx) Rollback() error {
+	tx.db.record("ROLLBACK", nil)
+	return nil
+}
+
+// fakeResult driver.Result
+type fakeResult struct {
+	id       int64
+	affected int64
+}
+
+func (r fakeResult) LastInsertId() (int64, error) {
+	return r.id, nil
+}
+
+func (r fakeResult) RowsAffected() (int64, error) {
+	return r.affected, nil
+}
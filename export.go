@@ -0,0 +1,187 @@
+package crud
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"sort"
+)
+
+// ExcelBOM UTF-8的BOM，Excel打开没有BOM的UTF-8 CSV文件中文会乱码。
+const ExcelBOM = "\xEF\xBB\xBF"
+
+// ColumnsByIndex 将DoubleSlice返回的列名索引转换成按照SELECT顺序的列名
+func ColumnsByIndex(index map[string]int) []string {
+	cols := make([]string, len(index))
+	for col, i := range index {
+		if i >= 0 && i < len(cols) {
+			cols[i] = col
+		}
+	}
+	return cols
+}
+
+// Columns 所有字段名，RowMap是无序的，所以按照名称排序。
+func (rm RowsMap) Columns() []string {
+	set := map[string]bool{}
+	cols := []string{}
+	for _, r := range rm {
+		for k := range r {
+			if !set[k] {
+				set[k] = true
+				cols = append(cols, k)
+			}
+		}
+	}
+	sort.Strings(cols)
+	return cols
+}
+
+// WriteCSV 将RowsMap写成CSV，columns为列的顺序，headers为表头。
+// columns为空时使用Columns()，headers为空时使用columns作为表头。
+func (rm RowsMap) WriteCSV(w io.Writer, columns []string, headers []string) error {
+	if len(columns) == 0 {
+		columns = rm.Columns()
+	}
+	if len(headers) == 0 {
+		headers = columns
+	}
+	cw := csv.NewWriter(w)
+	if err := cw.Write(headers); err != nil {
+		return err
+	}
+	record := make([]string, len(columns))
+	for _, r := range rm {
+		for i, col := range columns {
+			record[i] = r[col]
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteNDJSON 每行写一个JSON对象，字段的顺序为columns，columns为空时使用Columns()。
+func (rm RowsMap) WriteNDJSON(w io.Writer, columns []string) error {
+	if len(columns) == 0 {
+		columns = rm.Columns()
+	}
+	var buf bytes.Buffer
+	for _, r := range rm {
+		buf.Reset()
+		buf.WriteByte('{')
+		for i, col := range columns {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			writeJSONString(&buf, col)
+			buf.WriteByte(':')
+			writeJSONString(&buf, r[col])
+		}
+		buf.WriteString("}\n")
+		if _, err := w.Write(buf.Bytes()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeJSONString(buf *bytes.Buffer, s string) {
+	bs, _ := json.Marshal(s)
+	buf.Write(bs)
+}
+
+// WriteCSV 流式写CSV，列的顺序和SELECT一致，headers为空时使用列名作为表头。
+func (r *SQLRows) WriteCSV(w io.Writer, headers ...string) error {
+	return r.writeCSV(w, headers, false)
+}
+
+// writeCSV excel为true的时候会先写入BOM并使用\r\n换行
+func (r *SQLRows) writeCSV(w io.Writer, headers []string, excel bool) error {
+	if r.err != nil {
+		return r.err
+	}
+	if r.rows == nil {
+		return nil
+	}
+	cols, err := r.columns()
+	if err != nil {
+		r.rows.Close()
+		return err
+	}
+	if len(headers) == 0 {
+		headers = cols
+	}
+	if excel {
+		if _, err := io.WriteString(w, ExcelBOM); err != nil {
+			r.rows.Close()
+			return err
+		}
+	}
+	cw := csv.NewWriter(w)
+	cw.UseCRLF = excel
+	if err := cw.Write(headers); err != nil {
+		r.rows.Close()
+		return err
+	}
+	record := make([]string, len(cols))
+	err = r.eachRaw(func(cols []string, raws []sql.RawBytes) error {
+		for i, raw := range raws {
+			record[i] = string(raw)
+		}
+		return cw.Write(record)
+	})
+	if err != nil {
+		return err
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// ExportCSV 流式导出CSV，列的顺序和SELECT一致。
+// headers为空时使用列的注释(Column.Comment)作为表头，没有注释的使用列名。
+func (s *Search) ExportCSV(w io.Writer, headers ...string) error {
+	return s.exportCSV(w, headers, false)
+}
+
+// ExportExcelCSV 和ExportCSV一样，但是会写入BOM并使用\r\n换行，Excel可以直接打开。
+func (s *Search) ExportExcelCSV(w io.Writer, headers ...string) error {
+	return s.exportCSV(w, headers, true)
+}
+
+func (s *Search) exportCSV(w io.Writer, headers []string, excel bool) error {
+	query, args := s.Parse()
+	rows := s.queryRows(query, args...)
+	if len(headers) == 0 && rows.err == nil && rows.rows != nil {
+		cols, err := rows.columns()
+		if err != nil {
+			rows.rows.Close()
+			return err
+		}
+		headers = s.columnComments(cols)
+	}
+	return rows.writeCSV(w, headers, excel)
+}
+
+// columnComments 在主表和JOIN的表中查找列的注释
+func (s *Search) columnComments(cols []string) []string {
+	tables := []string{s.tableName}
+	for _, j := range s.joinConditions {
+		tables = append(tables, j.TableName)
+	}
+	comments := make([]string, len(cols))
+	for i, col := range cols {
+		comments[i] = col
+		for _, tableName := range tables {
+			if c, ok := s.table.tableColumns[tableName][col]; ok && c.Comment != "" {
+				comments[i] = c.Comment
+				break
+			}
+		}
+	}
+	return comments
+}
@@ -0,0 +1,101 @@
+package crud
+
+// FindAll 将Table当前条件查询到的所有数据放到[]T中，T为结构体，和DataBase.FindAll一样会查询关联的结构体。
+func FindAll[T any](t *Table) ([]T, error) {
+	out := make([]T, 0)
+	if err := t.Search.Clone().Finds(&out); err != nil {
+		return out, err
+	}
+	return out, nil
+}
+
+// Finds 将Search查询到的所有数据放到[]T中，T为结构体，只会调用AfterFind，不会查询关联的结构体。
+func Finds[T any](s *Search) ([]T, error) {
+	out := make([]T, 0)
+	if s.err != nil {
+		return out, s.err
+	}
+	query, args := s.Clone().Parse()
+	if err := s.table.Find(&out, append([]interface{}{query}, args...)...); err != nil {
+		return out, err
+	}
+	return out, nil
+}
+
+// First 返回Search查询到的第一条数据，T为结构体，没有数据的时候返回ErrNotFound。
+func First[T any](s *Search) (T, error) {
+	var zero T
+	out, err := Finds[T](s.Clone().Limit(1))
+	if err != nil {
+		return zero, err
+	}
+	if len(out) == 0 {
+		return zero, ErrNotFound
+	}
+	return out[0], nil
+}
+
+// Pluck 查询某一列的值，T可以是int、string、float64、sql.NullString等database/sql可以Scan的类型。
+func Pluck[T any](s *Search, field string) ([]T, error) {
+	out := make([]T, 0)
+	ns := s.Clone()
+	ns.fields = []string{field}
+	query, args := ns.Parse()
+	rows := s.queryRows(query, args...)
+	if rows.err != nil {
+		return out, rows.err
+	}
+	defer rows.rows.Close()
+	for rows.rows.Next() {
+		var v T
+		if err := rows.rows.Scan(&v); err != nil {
+			return out, err
+		}
+		out = append(out, v)
+	}
+	return out, rows.rows.Err()
+}
+
+// TypedRows 逐行读取查询结果的游标，每一行按照SQLRows.Next的规则转换成T，不会把所有数据加载到内存中。
+// Rows已经是保持列顺序的结果类型(见row.go)，所以类型化的游标叫TypedRows。
+//
+//	rows := crud.Iter[User](db.Table("user").Where("age > ?", 18).Search)
+//	defer rows.Close()
+//	for rows.Next() {
+//		u := rows.Value()
+//	}
+//	if err := rows.Err(); err != nil {
+//	}
+type TypedRows[T any] struct {
+	rows *SQLRows
+	cur  T
+}
+
+// Iter 执行Search的查询，返回T的游标，T可以是结构体或者int、string等单列的类型。
+func Iter[T any](s *Search) *TypedRows[T] {
+	query, args := s.Clone().Parse()
+	return &TypedRows[T]{rows: s.queryRows(query, args...)}
+}
+
+// Next 读取下一行，没有数据或者出错的时候返回false并关闭*sql.Rows。
+func (r *TypedRows[T]) Next() bool {
+	var v T
+	ok := r.rows.Next(&v)
+	r.cur = v
+	return ok
+}
+
+// Value 当前行的值
+func (r *TypedRows[T]) Value() T {
+	return r.cur
+}
+
+// Err 查询或者遍历过程中的错误
+func (r *TypedRows[T]) Err() error {
+	return r.rows.Err()
+}
+
+// Close 关闭*sql.Rows，没有遍历完就退出的时候需要调用。
+func (r *TypedRows[T]) Close() error {
+	return r.rows.Close()
+}
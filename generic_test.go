@@ -0,0 +1,106 @@
+package crud
+
+import (
+	"database/sql/driver"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type GenericUser struct {
+	ID   int
+	Name string
+	Age  int
+}
+
+func newGenericDataBase(t *testing.T) (*DataBase, *fakeDB) {
+	db, fdb := newFakeDataBase(t, map[string][]string{"generic_user": {"id", "name", "age"}})
+	fdb.query = func(query string, args []driver.Value) (*fakeRows, error) {
+		if strings.Contains(query, "age > ?") && args[0] == int64(100) {
+			return newFakeRows([]string{"id", "name", "age"}), nil
+		}
+		if strings.HasPrefix(query, "SELECT `generic_user`.`name` FROM") {
+			return newFakeRows([]string{"name"}, []driver.Value{[]byte("a")}, []driver.Value{[]byte("b")}), nil
+		}
+		return newFakeRows([]string{"id", "name", "age"},
+			[]driver.Value{int64(1), []byte("a"), int64(18)},
+			[]driver.Value{int64(2), []byte("b"), int64(20)},
+		), nil
+	}
+	return db, fdb
+}
+
+func TestFindAll(t *testing.T) {
+	db, fdb := newGenericDataBase(t)
+	users, err := FindAll[GenericUser](db.Table("generic_user").Where("age > ?", 1))
+	want := []GenericUser{{1, "a", 18}, {2, "b", 20}}
+	if err != nil || !reflect.DeepEqual(users, want) {
+		t.Fatalf("FindAll() = %v %v, want %v", users, err, want)
+	}
+	if stmts := fdb.statements(); len(stmts) != 1 || stmts[0] != "SELECT * FROM `generic_user` WHERE age > ?" {
+		t.Fatalf("FindAll() SQL = %v", stmts)
+	}
+	if users, err = FindAll[GenericUser](db.Table("generic_user").Where("age > ?", 100)); err != nil || users == nil || len(users) != 0 {
+		t.Fatalf("FindAll() on an empty result = %#v %v, want []", users, err)
+	}
+}
+
+func TestFirst(t *testing.T) {
+	db, fdb := newGenericDataBase(t)
+	u, err := First[GenericUser](db.Table("generic_user").Where("age > ?", 1).Search)
+	if err != nil || u != (GenericUser{1, "a", 18}) {
+		t.Fatalf("First() = %v %v", u, err)
+	}
+	if stmts := fdb.statements(); stmts[0] != "SELECT * FROM `generic_user` WHERE age > ? LIMIT ?" || fdb.args[0][1] != int64(1) {
+		t.Fatalf("First() SQL = %v %v", stmts, fdb.args)
+	}
+	u, err = First[GenericUser](db.Table("generic_user").Where("age > ?", 100).Search)
+	if !errors.Is(err, ErrNotFound) || u != (GenericUser{}) {
+		t.Fatalf("First() on an empty result = %v %v, want %v", u, err, ErrNotFound)
+	}
+}
+
+func TestPluck(t *testing.T) {
+	db, fdb := newGenericDataBase(t)
+	names, err := Pluck[string](db.Table("generic_user").OrderBy("id").Search, "name")
+	if err != nil || !reflect.DeepEqual(names, []string{"a", "b"}) {
+		t.Fatalf("Pluck() = %v %v", names, err)
+	}
+	if stmts := fdb.statements(); stmts[0] != "SELECT `generic_user`.`name` FROM `generic_user` ORDER BY id ASC" {
+		t.Fatalf("Pluck() SQL = %v", stmts)
+	}
+	if fdb.openRows() != 0 {
+		t.Fatalf("Pluck() left %d rows open", fdb.openRows())
+	}
+}
+
+func TestIter(t *testing.T) {
+	db, fdb := newGenericDataBase(t)
+	rows := Iter[GenericUser](db.Table("generic_user").Search)
+	var users []GenericUser
+	for rows.Next() {
+		users = append(users, rows.Value())
+	}
+	if err := rows.Err(); err != nil || !reflect.DeepEqual(users, []GenericUser{{1, "a", 18}, {2, "b", 20}}) {
+		t.Fatalf("Iter() = %v %v", users, err)
+	}
+	if fdb.openRows() != 0 {
+		t.Fatalf("Iter() left %d rows open", fdb.openRows())
+	}
+
+	rows = Iter[GenericUser](db.Table("generic_user").Search)
+	if !rows.Next() || rows.Value().ID != 1 {
+		t.Fatalf("Iter().Next() = %v", rows.Value())
+	}
+	rows.Close()
+	if fdb.openRows() != 0 {
+		t.Fatalf("Iter().Close() left %d rows open", fdb.openRows())
+	}
+
+	ages := Iter[int](db.Table("generic_user").Fields("age").Search)
+	defer ages.Close()
+	if !ages.Next() || ages.Value() != 1 {
+		t.Fatalf("Iter[int]().Next() = %v %v", ages.Value(), ages.Err())
+	}
+}
@@ -1,5 +1,5 @@
 module github.com/shesuyo/crud
 
-go 1.16
+go 1.18
 
 require github.com/go-sql-driver/mysql v1.5.0
@@ -0,0 +1,120 @@
+package crud
+
+import (
+	"context"
+	"reflect"
+)
+
+// 钩子函数的接口，tx为执行这次操作的DataBase，有钩子的时候Create、Update、Delete会在事务中执行，
+// 钩子返回error的时候操作会中止并回滚。
+// 以前的无参数方法BeforeCreate()、AfterCreate() error等依然可以使用。
+type (
+	// BeforeCreater 创建之前调用
+	BeforeCreater interface {
+		BeforeCreate(ctx context.Context, tx *DataBase) error
+	}
+	// AfterCreater 创建之后调用
+	AfterCreater interface {
+		AfterCreate(ctx context.Context, tx *DataBase) error
+	}
+	// BeforeUpdater 更新之前调用
+	BeforeUpdater interface {
+		BeforeUpdate(ctx context.Context, tx *DataBase) error
+	}
+	// AfterUpdater 更新之后调用
+	AfterUpdater interface {
+		AfterUpdate(ctx context.Context, tx *DataBase) error
+	}
+	// BeforeDeleter 删除之前调用
+	BeforeDeleter interface {
+		BeforeDelete(ctx context.Context, tx *DataBase) error
+	}
+	// AfterDeleter 删除之后调用
+	AfterDeleter interface {
+		AfterDelete(ctx context.Context, tx *DataBase) error
+	}
+	// AfterFinder 查询之后调用
+	AfterFinder interface {
+		AfterFind(ctx context.Context, tx *DataBase) error
+	}
+)
+
+// HookFunc 全局的钩子函数，obj为结构体的指针。
+type HookFunc func(ctx context.Context, tx *DataBase, obj interface{}) error
+
+// RegisterHook 注册对所有结构体生效的钩子，name为BeforeCreate、AfterCreate等。
+// 全局的钩子在结构体自己的钩子之前执行，需要在使用之前注册，不能和其他操作并发调用。
+func (db *DataBase) RegisterHook(name string, f HookFunc) *DataBase {
+	if db.hooks == nil {
+		db.hooks = make(map[string][]HookFunc)
+	}
+	db.hooks[name] = append(db.hooks[name], f)
+	return db
+}
+
+// callHook 调用全局的钩子以及结构体(指针)v的钩子，有钩子返回error的时候返回这个error。
+func (db *DataBase) callHook(v reflect.Value, name string) error {
+	ctx := db.Context()
+	obj := v.Interface()
+	for _, f := range db.hooks[name] {
+		if err := f(ctx, db, obj); err != nil {
+			return err
+		}
+	}
+	switch name {
+	case BeforeCreate:
+		if h, ok := obj.(BeforeCreater); ok {
+			return h.BeforeCreate(ctx, db)
+		}
+	case AfterCreate:
+		if h, ok := obj.(AfterCreater); ok {
+			return h.AfterCreate(ctx, db)
+		}
+	case BeforeUpdate:
+		if h, ok := obj.(BeforeUpdater); ok {
+			return h.BeforeUpdate(ctx, db)
+		}
+	case AfterUpdate:
+		if h, ok := obj.(AfterUpdater); ok {
+			return h.AfterUpdate(ctx, db)
+		}
+	case BeforeDelete:
+		if h, ok := obj.(BeforeDeleter); ok {
+			return h.BeforeDelete(ctx, db)
+		}
+	case AfterDelete:
+		if h, ok := obj.(AfterDeleter); ok {
+			return h.AfterDelete(ctx, db)
+		}
+	case AfterFind:
+		if h, ok := obj.(AfterFinder); ok {
+			return h.AfterFind(ctx, db)
+		}
+	}
+	// 以前没有参数的钩子
+	fn := v.MethodByName(name)
+	if !fn.IsValid() || fn.Type().NumIn() != 0 {
+		return nil
+	}
+	vals := fn.Call(nil)
+	if len(vals) == 1 {
+		if err, ok := vals[0].Interface().(error); ok {
+			return err
+		}
+	}
+	return nil
+}
+
+// hasHook 结构体(指针)v是否有names中的任意一个钩子，包括全局的钩子。
+func (db *DataBase) hasHook(v reflect.Value, names ...string) bool {
+	for _, name := range names {
+		if len(db.hooks[name]) > 0 {
+			return true
+		}
+		// 钩子的接口和以前没有参数的钩子方法名都和name相同
+		if v.MethodByName(name).IsValid() {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,48 @@
+package crud
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type testHookUser struct {
+	ID    int
+	calls []string
+}
+
+func (u *testHookUser) BeforeCreate(ctx context.Context, tx *DataBase) error {
+	u.calls = append(u.calls, "BeforeCreate")
+	if u.ID < 0 {
+		return errors.New("bad id")
+	}
+	return nil
+}
+
+// 以前没有参数的钩子
+func (u *testHookUser) AfterFind() {
+	u.calls = append(u.calls, "AfterFind")
+}
+
+func TestCallHook(t *testing.T) {
+	db := newTestDataBase(nil)
+	db.RegisterHook(BeforeCreate, func(ctx context.Context, tx *DataBase, obj interface{}) error {
+		obj.(*testHookUser).calls = append(obj.(*testHookUser).calls, "global")
+		return nil
+	})
+	u := &testHookUser{ID: 1}
+	v := reflect.ValueOf(u)
+	for _, name := range []string{BeforeCreate, AfterCreate, AfterFind} {
+		if err := db.callHook(v, name); err != nil {
+			t.Fatalf("callHook(%s) err = %v", name, err)
+		}
+	}
+	if want := []string{"global", "BeforeCreate", "AfterFind"}; !reflect.DeepEqual(u.calls, want) {
+		t.Fatalf("callHook() calls = %v, want %v", u.calls, want)
+	}
+	u.ID = -1
+	if err := db.callHook(v, BeforeCreate); err == nil {
+		t.Fatal("callHook() want error from BeforeCreate")
+	}
+}
@@ -0,0 +1,64 @@
+package crud
+
+// LeftJoin 和SQL的LEFT JOIN一样将两个RowsMap按照rm[leftKey] = other[rightKey]连接起来，
+// other中的字段会加上prefix前缀，没有匹配到的行other中的字段为""，字段重名的时候以rm中的为准。
+// 用于连接来自不同数据库或者缓存中的数据。
+func (rm RowsMap) LeftJoin(other RowsMap, leftKey, rightKey, prefix string) RowsMap {
+	return rm.join(other, leftKey, rightKey, prefix, false)
+}
+
+// InnerJoin 和SQL的INNER JOIN一样，只保留两边都匹配的行，其他规则和LeftJoin一样。
+func (rm RowsMap) InnerJoin(other RowsMap, leftKey, rightKey, prefix string) RowsMap {
+	return rm.join(other, leftKey, rightKey, prefix, true)
+}
+
+func (rm RowsMap) join(other RowsMap, leftKey, rightKey, prefix string, inner bool) RowsMap {
+	out := make(RowsMap, 0, len(rm))
+	idx := other.MapIndexs(rightKey)
+	rightCols := other.Columns()
+	for _, l := range rm {
+		matches, ok := idx[l[leftKey]]
+		if !ok {
+			if inner {
+				continue
+			}
+			nr := make(RowMap, len(l)+len(rightCols))
+			for _, col := range rightCols {
+				nr[prefix+col] = ""
+			}
+			for k, v := range l {
+				nr[k] = v
+			}
+			out = append(out, nr)
+			continue
+		}
+		for _, m := range matches {
+			nr := make(RowMap, len(l)+len(m))
+			for k, v := range m {
+				nr[prefix+k] = v
+			}
+			for k, v := range l {
+				nr[k] = v
+			}
+			out = append(out, nr)
+		}
+	}
+	return out
+}
+
+// Nest 一对多的关联，将other中other[fkey] = rm[key]的行放到as字段中，没有的时候为空的RowsMap。
+// 返回RowsMapInterface，可以直接输出成嵌套的JSON。
+func (rm RowsMap) Nest(other RowsMap, key, fkey, as string) RowsMapInterface {
+	out := make(RowsMapInterface, 0, len(rm))
+	idx := other.MapIndexs(fkey)
+	for _, r := range rm {
+		nr := r.Interface()
+		children, ok := idx[r[key]]
+		if !ok {
+			children = RowsMap{}
+		}
+		nr[as] = children
+		out = append(out, nr)
+	}
+	return out
+}
@@ -0,0 +1,287 @@
+package crud
+
+import (
+	"database/sql/driver"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// 结构体的tag
+// db:"column,pk,autoincr,readonly,omitempty"
+//
+//	column    对应的列名，为空时使用ToDBName(字段名)
+//	pk        主键，没有标记时使用表结构中的主键(COLUMN_KEY = 'PRI')，再没有时为id
+//	autoincr  自增，创建的时候为零值则不插入，创建后会回填
+//	readonly  只读，创建和更新的时候都不会写入
+//	omitempty 零值的时候不写入
+//
+// db:"-" 忽略此字段
+// 以前的dbname:"column"、crud:"ignore"、crud:"-"依然可以使用，db中的列名优先。
+const (
+	tagDB     = "db"
+	tagDBName = "dbname"
+	tagCRUD   = "crud"
+)
+
+var (
+	modelCache  sync.Map // map[reflect.Type]*modelStruct
+	valuerType  = reflect.TypeOf((*driver.Valuer)(nil)).Elem()
+	bytesType   = reflect.TypeOf([]byte(nil))
+	defaultPKDB = "id"
+)
+
+// modelStruct 结构体的描述，每个类型只会解析一次。
+type modelStruct struct {
+	typ       reflect.Type
+	fields    []*modelField          // 所有导出的字段，包括忽略的字段，用于NewModel
+	columns   []*modelField          // 对应数据库列的字段
+	byColumn  map[string]*modelField // 列名 => 字段
+	byName    map[string]*modelField // 字段名 => 字段
+	pks       []*modelField          // tag中标记的主键，没有标记时为ID字段
+	pkByID    bool                   // pks是否是默认的ID字段
+	snapshot  []int                  // 嵌入的Snapshot的位置，没有时为nil
+	relations []*modelField          // crud tag中声明了关联的字段
+}
+
+// modelField 结构体字段的描述
+type modelField struct {
+	name      string
+	column    string
+	index     []int
+	typ       reflect.Type
+	pk        bool
+	autoIncr  bool
+	readOnly  bool
+	omitEmpty bool
+	ignore    bool
+	assoc     bool      // 结构体、slice等不是列的字段，用于关联
+	rel       *relation // 声明的关联，见association.go
+	require   map[string]bool
+}
+
+// getModel 获取类型对应的描述，t可以是结构体或者指向结构体的指针。
+func getModel(t reflect.Type) *modelStruct {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if ms, ok := modelCache.Load(t); ok {
+		return ms.(*modelStruct)
+	}
+	ms := parseModel(t)
+	actual, _ := modelCache.LoadOrStore(t, ms)
+	return actual.(*modelStruct)
+}
+
+func parseModel(t reflect.Type) *modelStruct {
+	ms := &modelStruct{
+		typ:      t,
+		byColumn: make(map[string]*modelField),
+		byName:   make(map[string]*modelField),
+	}
+	if t.Kind() != reflect.Struct {
+		return ms
+	}
+	ms.parseFields(t, nil)
+	for _, f := range ms.columns {
+		if f.pk {
+			ms.pks = append(ms.pks, f)
+		}
+	}
+	if len(ms.pks) == 0 {
+		if f, ok := ms.byColumn[defaultPKDB]; ok {
+			f.pk = true
+			f.autoIncr = isIntKind(f.typ.Kind())
+			ms.pks = append(ms.pks, f)
+			ms.pkByID = true
+		}
+	}
+	return ms
+}
+
+// parseFields 解析字段，匿名的结构体字段会展开。
+func (ms *modelStruct) parseFields(t reflect.Type, index []int) {
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" && !sf.Anonymous {
+			continue
+		}
+		fieldIndex := append(index[:len(index):len(index)], i)
+		if sf.Anonymous && sf.Type == snapshotType {
+			ms.snapshot = fieldIndex
+			continue
+		}
+		dbTag, hasDBTag := sf.Tag.Lookup(tagDB)
+		if sf.Anonymous && sf.Type.Kind() == reflect.Struct && !hasDBTag && sf.Tag.Get(tagDBName) == "" && !isValueType(sf.Type) {
+			ms.parseFields(sf.Type, fieldIndex)
+			continue
+		}
+		if sf.PkgPath != "" {
+			continue
+		}
+		f := &modelField{
+			name:   sf.Name,
+			column: ToDBName(sf.Name),
+			index:  fieldIndex,
+			typ:    sf.Type,
+			require: map[string]bool{
+				C: sf.Tag.Get("c") == "require",
+				R: sf.Tag.Get("r") == "require",
+				U: sf.Tag.Get("u") == "require",
+				D: sf.Tag.Get("d") == "require",
+			},
+		}
+		if name := sf.Tag.Get(tagDBName); name != "" {
+			f.column = name
+		}
+		crudTag := sf.Tag.Get(tagCRUD)
+		if crudTag == "ignore" || crudTag == "-" || dbTag == "-" {
+			f.ignore = true
+		}
+		if dbTag != "" && dbTag != "-" {
+			opts := strings.Split(dbTag, ",")
+			if name := strings.TrimSpace(opts[0]); name != "" {
+				f.column = name
+			}
+			for _, opt := range opts[1:] {
+				switch strings.TrimSpace(opt) {
+				case "pk":
+					f.pk = true
+				case "autoincr":
+					f.autoIncr = true
+				case "readonly":
+					f.readOnly = true
+				case "omitempty":
+					f.omitEmpty = true
+				}
+			}
+		}
+		f.assoc = !f.ignore && !isValueType(sf.Type)
+		ms.fields = append(ms.fields, f)
+		ms.byName[f.name] = f
+		if f.assoc && crudTag != "" {
+			if f.rel = parseRelation(crudTag, ms.typ, f); f.rel != nil {
+				ms.relations = append(ms.relations, f)
+			}
+		}
+		if f.ignore || f.assoc {
+			continue
+		}
+		if _, ok := ms.byColumn[f.column]; ok {
+			// 同名的列以外层的为准
+			continue
+		}
+		ms.columns = append(ms.columns, f)
+		ms.byColumn[f.column] = f
+	}
+}
+
+// primaryKeys 结构体在表cols中的主键字段，以及自增的主键字段(没有时为nil)。
+// tag中标记了pk的优先，其次是表结构中的主键(COLUMN_KEY = 'PRI')，最后是ID字段。
+// 表结构中的主键需要都能在结构体中找到对应的字段才会使用。
+func (ms *modelStruct) primaryKeys(cols Columns) (pks []*modelField, autoIncr *modelField) {
+	pks = ms.pks
+	if len(pks) == 0 || ms.pkByID {
+		if names := cols.PrimaryKeys(); len(names) > 0 {
+			found := make([]*modelField, 0, len(names))
+			for _, name := range names {
+				if f, ok := ms.byColumn[name]; ok {
+					found = append(found, f)
+				}
+			}
+			if len(found) == len(names) {
+				pks = found
+			}
+		}
+	}
+	for _, f := range pks {
+		col, ok := cols[f.column]
+		// 默认的ID字段有表结构的时候以表结构为准
+		if ok && col.IsAutoIncrement() || f.autoIncr && (!ok || !ms.pkByID) {
+			return pks, f
+		}
+	}
+	return pks, nil
+}
+
+// pkMap 主键列对应的值，有主键为零值或者没有主键时返回ErrMustNeedID。
+func pkMap(v reflect.Value, pks []*modelField) (map[string]interface{}, error) {
+	v = reflect.Indirect(v)
+	if len(pks) == 0 {
+		return nil, ErrMustNeedID
+	}
+	m := make(map[string]interface{}, len(pks))
+	for _, f := range pks {
+		fv := v.FieldByIndex(f.index)
+		if isBlank(fv) {
+			return nil, ErrMustNeedID
+		}
+		m[f.column] = fv.Interface()
+	}
+	return m, nil
+}
+
+// pkColumns 主键字段的列名
+func pkColumns(pks []*modelField) []string {
+	cols := make([]string, len(pks))
+	for i, f := range pks {
+		cols[i] = f.column
+	}
+	return cols
+}
+
+// field 根据字段名或者列名查找字段
+func (ms *modelStruct) field(name string) (*modelField, bool) {
+	if f, ok := ms.byName[name]; ok && !f.ignore && !f.assoc {
+		return f, true
+	}
+	f, ok := ms.byColumn[name]
+	return f, ok
+}
+
+// toMap 将结构体的列转换成map，write为true时会去掉只读、omitempty的零值字段，
+// create为true时还会去掉零值的自增字段。
+func (ms *modelStruct) toMap(v reflect.Value, write, create bool) map[string]interface{} {
+	v = reflect.Indirect(v)
+	m := make(map[string]interface{}, len(ms.columns))
+	for _, f := range ms.columns {
+		fv := v.FieldByIndex(f.index)
+		if write {
+			if f.readOnly {
+				continue
+			}
+			if (f.omitEmpty || create && f.autoIncr) && isBlank(fv) {
+				continue
+			}
+		}
+		m[f.column] = fv.Interface()
+	}
+	return m
+}
+
+// isValueType 是否是可以直接作为一列的类型，其他的结构体、slice等被当作关联。
+func isValueType(t reflect.Type) bool {
+	if t.Implements(valuerType) || reflect.PtrTo(t).Implements(valuerType) || reflect.PtrTo(t).Implements(scannerType) {
+		return true
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		return isValueType(t.Elem())
+	case reflect.Struct:
+		return t == timeType
+	case reflect.Slice:
+		return t == bytesType || t.Elem().Kind() == reflect.Uint8
+	case reflect.Map, reflect.Array, reflect.Chan, reflect.Func:
+		return false
+	}
+	return true
+}
+
+func isIntKind(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
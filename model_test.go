@@ -0,0 +1,107 @@
+package crud
+
+import (
+	"database/sql"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type testBase struct {
+	ID        int64
+	CreatedAt time.Time `db:",readonly"`
+}
+
+type testPost struct {
+	testBase
+	Title    string `db:"subject"`
+	Summary  string `dbname:"abstract"`
+	Views    int    `db:",omitempty"`
+	Secret   string `crud:"ignore"`
+	Draft    string `db:"-"`
+	Remark   sql.NullString
+	Author   *testAuthor
+	Comments []testComment
+}
+
+type testAuthor struct {
+	Code string `db:"code,pk"`
+	Name string
+}
+
+type testComment struct {
+	ID     int
+	PostID int64
+}
+
+func TestGetModel(t *testing.T) {
+	ms := getModel(reflect.TypeOf(&testPost{}))
+	if ms != getModel(reflect.TypeOf(testPost{})) {
+		t.Fatal("getModel() should be cached")
+	}
+	cols := []string{}
+	for _, f := range ms.columns {
+		cols = append(cols, f.column)
+	}
+	if want := []string{"id", "created_at", "subject", "abstract", "views", "remark"}; !reflect.DeepEqual(cols, want) {
+		t.Fatalf("getModel() columns = %v, want %v", cols, want)
+	}
+	if len(ms.pks) != 1 || ms.pks[0].column != "id" || !ms.pks[0].autoIncr {
+		t.Fatalf("getModel() pks = %+v", ms.pks)
+	}
+	if !ms.byName["Author"].assoc || !ms.byName["Comments"].assoc {
+		t.Fatal("getModel() Author and Comments should be associations")
+	}
+	if pks := getModel(reflect.TypeOf(testAuthor{})).pks; len(pks) != 1 || pks[0].column != "code" || pks[0].autoIncr {
+		t.Fatalf("getModel() author pks = %+v", pks)
+	}
+
+	p := testPost{Title: "t", Remark: sql.NullString{String: "r", Valid: true}}
+	m := ms.toMap(reflect.ValueOf(&p), true, true)
+	want := map[string]interface{}{"subject": "t", "abstract": "", "remark": p.Remark}
+	if !reflect.DeepEqual(m, want) {
+		t.Fatalf("toMap() = %v, want %v", m, want)
+	}
+}
+
+type testGroupUser struct {
+	GroupID int64
+	UserID  int64
+	Role    string
+}
+
+func TestPrimaryKeys(t *testing.T) {
+	cols := Columns{
+		"role":     Column{Name: "role", Position: 3},
+		"user_id":  Column{Name: "user_id", Key: "PRI", Position: 2},
+		"group_id": Column{Name: "group_id", Key: "PRI", Position: 1},
+	}
+	if pks := cols.PrimaryKeys(); !reflect.DeepEqual(pks, []string{"group_id", "user_id"}) {
+		t.Fatalf("PrimaryKeys() = %v", pks)
+	}
+	pks, autoIncr := getModel(reflect.TypeOf(testGroupUser{})).primaryKeys(cols)
+	if !reflect.DeepEqual(pkColumns(pks), []string{"group_id", "user_id"}) || autoIncr != nil {
+		t.Fatalf("primaryKeys() = %v, %v", pkColumns(pks), autoIncr)
+	}
+	if _, err := pkMap(reflect.ValueOf(testGroupUser{GroupID: 1}), pks); err != ErrMustNeedID {
+		t.Fatalf("pkMap() err = %v, want ErrMustNeedID", err)
+	}
+	m, err := pkMap(reflect.ValueOf(testGroupUser{GroupID: 1, UserID: 2}), pks)
+	if err != nil || !reflect.DeepEqual(m, map[string]interface{}{"group_id": int64(1), "user_id": int64(2)}) {
+		t.Fatalf("pkMap() = %v, %v", m, err)
+	}
+
+	ms := getModel(reflect.TypeOf(testComment{}))
+	if _, autoIncr := ms.primaryKeys(nil); autoIncr == nil || autoIncr.column != "id" {
+		t.Fatal("primaryKeys() id should be auto increment without schema")
+	}
+	noAuto := Columns{"id": Column{Name: "id", Key: "PRI"}}
+	if _, autoIncr := ms.primaryKeys(noAuto); autoIncr != nil {
+		t.Fatal("primaryKeys() schema without auto_increment")
+	}
+	// tag中标记的主键优先于表结构
+	author := getModel(reflect.TypeOf(testAuthor{}))
+	if pks, _ := author.primaryKeys(Columns{"name": Column{Name: "name", Key: "PRI"}}); !reflect.DeepEqual(pkColumns(pks), []string{"code"}) {
+		t.Fatalf("primaryKeys() tagged = %v", pkColumns(pks))
+	}
+}
@@ -0,0 +1,181 @@
+package crud
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Named 将:name和@name形式的命名参数转换成?形式的位置参数
+// arg可以是map[string]interface{}或者结构体，结构体字段名规则和structToMap一样(dbname、crud:"ignore")。
+// slice类型的参数会被展开，用于IN (:ids)，空的slice会被替换成NULL。
+// 字符串、反引号中的内容以及::、:=、@@不会被替换；@name找不到参数时会原样保留，因为它可能是MySQL的用户变量。
+func Named(query string, arg interface{}) (string, []interface{}, error) {
+	m, err := namedMap(arg)
+	if err != nil {
+		return query, nil, err
+	}
+	var (
+		sb   strings.Builder
+		args []interface{}
+		l    = len(query)
+	)
+	sb.Grow(l)
+	for i := 0; i < l; i++ {
+		c := query[i]
+		switch c {
+		case '\'', '"', '`':
+			j := quotedEnd(query, i)
+			sb.WriteString(query[i : j+1])
+			i = j
+		case ':', '@':
+			if i+1 < l && (query[i+1] == c || query[i+1] == '=') {
+				sb.WriteString(query[i : i+2])
+				i++
+				continue
+			}
+			j := i + 1
+			for j < l && isNameChar(query[j]) {
+				j++
+			}
+			name := query[i+1 : j]
+			val, ok := m[name]
+			if name == "" || (!ok && c == '@') {
+				sb.WriteString(query[i:j])
+				i = j - 1
+				continue
+			}
+			if !ok {
+				return query, nil, fmt.Errorf("%w: 缺少命名参数%s", ErrArgs, name)
+			}
+			vals := expandNamedValue(val)
+			if vals == nil {
+				sb.WriteString("?")
+				args = append(args, val)
+			} else if len(vals) == 0 {
+				sb.WriteString("NULL")
+			} else {
+				sb.WriteString(placeholder(len(vals)))
+				args = append(args, vals...)
+			}
+			i = j - 1
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return sb.String(), args, nil
+}
+
+// quotedEnd 从query[i]的引号开始，返回对应的结束引号的位置，没有结束引号时返回最后一个字符的位置。
+func quotedEnd(query string, i int) int {
+	c, l := query[i], len(query)
+	j := i + 1
+	for ; j < l; j++ {
+		if query[j] == '\\' && c != '`' {
+			j++
+			continue
+		}
+		if query[j] == c {
+			if j+1 < l && query[j+1] == c {
+				j++
+				continue
+			}
+			break
+		}
+	}
+	if j >= l {
+		j = l - 1
+	}
+	return j
+}
+
+// hasNamedParam query中是否有:name或者@name，跳过的内容和Named一样。
+func hasNamedParam(query string) bool {
+	for i, l := 0, len(query); i < l; i++ {
+		switch c := query[i]; c {
+		case '\'', '"', '`':
+			i = quotedEnd(query, i)
+		case ':', '@':
+			if i+1 < l && (query[i+1] == c || query[i+1] == '=') {
+				i++
+			} else if i+1 < l && isNameChar(query[i+1]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// namedArgs 如果query中有命名参数，并且只有一个map或者结构体参数，则当作命名参数处理。
+func namedArgs(query string, args []interface{}) (string, []interface{}, error) {
+	if len(args) != 1 || !isNamedArg(args[0]) || !hasNamedParam(query) {
+		return query, args, nil
+	}
+	return Named(query, args[0])
+}
+
+func isNamedArg(arg interface{}) bool {
+	if arg == nil || isValueType(reflect.TypeOf(arg)) {
+		return false
+	}
+	v := reflect.Indirect(reflect.ValueOf(arg))
+	switch v.Kind() {
+	case reflect.Map:
+		return v.Type().Key().Kind() == reflect.String
+	case reflect.Struct:
+		return true
+	}
+	return false
+}
+
+func namedMap(arg interface{}) (map[string]interface{}, error) {
+	if m, ok := arg.(map[string]interface{}); ok {
+		return m, nil
+	}
+	v := reflect.ValueOf(arg)
+	if v.Kind() == reflect.Ptr && v.IsNil() {
+		return nil, ErrArgs
+	}
+	v = reflect.Indirect(v)
+	switch v.Kind() {
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return nil, ErrNotSupportType
+		}
+		m := make(map[string]interface{}, v.Len())
+		for _, k := range v.MapKeys() {
+			m[k.String()] = v.MapIndex(k).Interface()
+		}
+		return m, nil
+	case reflect.Struct:
+		return structToMap(v), nil
+	}
+	return nil, ErrNotSupportType
+}
+
+// expandNamedValue 如果是slice则返回展开后的参数，否则返回nil。
+func expandNamedValue(val interface{}) []interface{} {
+	if val == nil {
+		return nil
+	}
+	if _, ok := val.(driver.Valuer); ok {
+		return nil
+	}
+	v := reflect.ValueOf(val)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return nil
+	}
+	if v.Type().Elem().Kind() == reflect.Uint8 {
+		return nil
+	}
+	vals := make([]interface{}, 0, v.Len())
+	for i := 0; i < v.Len(); i++ {
+		vals = append(vals, v.Index(i).Interface())
+	}
+	return vals
+}
+
+func isNameChar(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
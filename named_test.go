@@ -0,0 +1,80 @@
+package crud
+
+import (
+	"database/sql/driver"
+	"reflect"
+	"testing"
+)
+
+func TestNamed(t *testing.T) {
+	type order struct {
+		UserID int
+		Status int    `dbname:"state"`
+		Remark string `crud:"ignore"`
+	}
+	tests := []struct {
+		name      string
+		query     string
+		arg       interface{}
+		wantQuery string
+		wantArgs  []interface{}
+		wantErr   bool
+	}{
+		{"map", "SELECT * FROM a WHERE uid = :uid OR owner = :uid", map[string]interface{}{"uid": 3}, "SELECT * FROM a WHERE uid = ? OR owner = ?", []interface{}{3, 3}, false},
+		{"in", "SELECT * FROM a WHERE id IN (:ids) AND name = @name", map[string]interface{}{"ids": []int{1, 2, 3}, "name": "x"}, "SELECT * FROM a WHERE id IN (?,?,?) AND name = ?", []interface{}{1, 2, 3, "x"}, false},
+		{"empty in", "SELECT * FROM a WHERE id IN (:ids)", map[string]interface{}{"ids": []int{}}, "SELECT * FROM a WHERE id IN (NULL)", nil, false},
+		{"quote", "SELECT ':a', `:a`, DATE_FORMAT(t, '%H:%i') FROM a WHERE b = :a", map[string]interface{}{"a": 1}, "SELECT ':a', `:a`, DATE_FORMAT(t, '%H:%i') FROM a WHERE b = ?", []interface{}{1}, false},
+		{"mysql var", "SELECT @@sql_mode, @row := @row + 1 FROM a WHERE b = :b", map[string]interface{}{"b": 1}, "SELECT @@sql_mode, @row := @row + 1 FROM a WHERE b = ?", []interface{}{1}, false},
+		{"struct", "UPDATE a SET state = :state WHERE user_id = :user_id", &order{UserID: 1, Status: 2}, "UPDATE a SET state = ? WHERE user_id = ?", []interface{}{2, 1}, false},
+		{"missing", "SELECT * FROM a WHERE remark = :remark", order{}, "", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, args, err := Named(tt.query, tt.arg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Named() err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if query != tt.wantQuery || !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Errorf("Named() = %s %v, want %s %v", query, args, tt.wantQuery, tt.wantArgs)
+			}
+		})
+	}
+}
+
+// namedMoney 指针接收者实现driver.Valuer
+type namedMoney struct {
+	cents int64
+}
+
+func (m *namedMoney) Value() (driver.Value, error) {
+	return m.cents, nil
+}
+
+func TestNamedArgs(t *testing.T) {
+	type filter struct {
+		Price int
+	}
+	tests := []struct {
+		name      string
+		query     string
+		arg       interface{}
+		wantQuery string
+		wantArgs  []interface{}
+	}{
+		{"valuer", "price = ?", namedMoney{5}, "price = ?", []interface{}{namedMoney{5}}},
+		{"valuer pointer", "price = ?", &namedMoney{5}, "price = ?", []interface{}{&namedMoney{5}}},
+		{"struct without names", "price = ?", filter{5}, "price = ?", []interface{}{filter{5}}},
+		{"quoted name", "remark = ':price' AND price = ?", filter{5}, "remark = ':price' AND price = ?", []interface{}{filter{5}}},
+		{"struct", "price = :price", filter{5}, "price = ?", []interface{}{5}},
+		{"map", "price = @price", map[string]int{"price": 5}, "price = ?", []interface{}{5}},
+	}
+	for _, tt := range tests {
+		query, args, err := namedArgs(tt.query, []interface{}{tt.arg})
+		if err != nil || query != tt.wantQuery || !reflect.DeepEqual(args, tt.wantArgs) {
+			t.Errorf("%s: namedArgs() = %s %v %v, want %s %v", tt.name, query, args, err, tt.wantQuery, tt.wantArgs)
+		}
+	}
+}
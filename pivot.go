@@ -0,0 +1,90 @@
+package crud
+
+import "sort"
+
+// PivotOption RowsMap.Pivot的参数
+type PivotOption struct {
+	Fill     string // 没有数据的单元格的值，默认为""
+	RowTotal bool   // 每行最后加一列合计
+	ColTotal bool   // 最后加一行合计
+	TotalKey string // 合计的列名和行名，默认为total
+}
+
+// PivotTable 透视表
+type PivotTable struct {
+	RowKey  string   `json:"row_key"`
+	Columns []string `json:"columns"` // 列头，不包括RowKey，有RowTotal的时候最后一列为TotalKey
+	Rows    RowsMap  `json:"rows"`
+}
+
+// Pivot 透视表(交叉表)，以rowKey的值为行，colKey的值为列，单元格为valueField按照aggFunc聚合的结果。
+// aggFunc和RowsMap.Aggregate一样，比如AggSum、AggCount。
+// 行按照第一次出现的顺序，列按照值排序(都是数字的时候按照数字排序)。
+// 合计是对原始数据重新聚合的结果，所以AggAvg等的合计也是正确的。
+func (rm RowsMap) Pivot(rowKey, colKey, valueField, aggFunc string, opts ...PivotOption) PivotTable {
+	var opt PivotOption
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
+	if opt.TotalKey == "" {
+		opt.TotalKey = "total"
+	}
+	agg := Agg{Func: aggFunc, Field: valueField, As: "pivot_value"}
+	fill := func(v string) string {
+		if v == "" {
+			return opt.Fill
+		}
+		return v
+	}
+
+	cells := rm.Aggregate([]string{rowKey, colKey}, agg)
+	cols := []string{}
+	seen := map[string]bool{}
+	for _, c := range cells {
+		if !seen[c[colKey]] {
+			seen[c[colKey]] = true
+			cols = append(cols, c[colKey])
+		}
+	}
+	sort.SliceStable(cols, func(i, j int) bool {
+		return compareValue(cols[i], cols[j]) < 0
+	})
+
+	rows := RowsMap{}
+	index := map[string]RowMap{}
+	for _, c := range cells {
+		r, ok := index[c[rowKey]]
+		if !ok {
+			r = RowMap{rowKey: c[rowKey]}
+			for _, col := range cols {
+				r[col] = opt.Fill
+			}
+			index[c[rowKey]] = r
+			rows = append(rows, r)
+		}
+		r[c[colKey]] = fill(c["pivot_value"])
+	}
+
+	if opt.RowTotal {
+		for _, t := range rm.Aggregate([]string{rowKey}, agg) {
+			index[t[rowKey]][opt.TotalKey] = fill(t["pivot_value"])
+		}
+	}
+	if opt.ColTotal {
+		total := RowMap{rowKey: opt.TotalKey}
+		for _, col := range cols {
+			total[col] = opt.Fill
+		}
+		for _, t := range rm.Aggregate([]string{colKey}, agg) {
+			total[t[colKey]] = fill(t["pivot_value"])
+		}
+		if opt.RowTotal {
+			total[opt.TotalKey] = fill(rm.Aggregate(nil, agg)[0]["pivot_value"])
+		}
+		rows = append(rows, total)
+	}
+	if opt.RowTotal {
+		cols = append(cols, opt.TotalKey)
+	}
+	return PivotTable{RowKey: rowKey, Columns: cols, Rows: rows}
+}
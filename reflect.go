@@ -32,6 +32,7 @@ const (
 	UpdatedAt = "updated_at"
 	DeletedAt = "deleted_at"
 	IsDeleted = "is_deleted"
+	Version   = "version"
 )
 
 // DBColums 多列
@@ -48,22 +49,24 @@ type Model struct {
 }
 
 // NewModel *Model
+// 结构体的描述是缓存的，这里只会读取字段的值。
 func NewModel(v interface{}) *Model {
-	val := reflect.ValueOf(v)
-	t := reflect.Indirect(val)
-	fs := []Field{}
-	for i := 0; i < t.NumField(); i++ {
-		reflectField := t.Type().Field(i) //reflect.Type Field
+	val := reflect.Indirect(reflect.ValueOf(v))
+	ms := getModel(val.Type())
+	fs := make([]Field, 0, len(ms.fields))
+	for _, mf := range ms.fields {
+		fv := val.FieldByIndex(mf.index)
 		f := Field{
-			name:       reflectField.Name,
-			dbName:     ToDBName(reflectField.Name),
-			value:      t.Field(i).Interface(),
-			isBlank:    isBlank(t.Field(i)),
-			iscRequire: reflectField.Tag.Get("c") == "require",
-			isrRequire: reflectField.Tag.Get("r") == "require",
-			isuRequire: reflectField.Tag.Get("u") == "require",
-			isdRequire: reflectField.Tag.Get("d") == "require",
-			isIgnore:   reflectField.Tag.Get("crud") == "ignore",
+			name:       mf.name,
+			dbName:     mf.column,
+			value:      fv.Interface(),
+			isBlank:    isBlank(fv),
+			iscRequire: mf.require[C],
+			isrRequire: mf.require[R],
+			isuRequire: mf.require[U],
+			isdRequire: mf.require[D],
+			isIgnore:   mf.ignore,
+			isReadOnly: mf.readOnly,
 		}
 		fs = append(fs, f)
 	}
@@ -86,6 +89,7 @@ type Field struct {
 	isuRequire bool
 	isdRequire bool
 	isIgnore   bool
+	isReadOnly bool
 }
 
 // Name 对应的结构体字段名
@@ -128,6 +132,11 @@ func (f *Field) IsIgnore() bool {
 	return f.isIgnore
 }
 
+// IsReadOnly 是否只读，只读的字段创建和更新的时候不会写入
+func (f *Field) IsReadOnly() bool {
+	return f.isReadOnly
+}
+
 // 获取结构体对应的数据库名
 func getStructDBName(v reflect.Value) string {
 	v = reflect.Indirect(v)
@@ -142,16 +151,6 @@ func getStructDBName(v reflect.Value) string {
 	return dbName
 }
 
-// 获取结构体ID
-func getStructID(v reflect.Value) int64 {
-	v = reflect.Indirect(v)
-	rID := v.FieldByName("ID")
-	if rID.IsValid() {
-		return rID.Int()
-	}
-	return 0
-}
-
 // 检查反射的值是否为默认值，如果为默认值则默认为空值。
 func isBlank(value reflect.Value) bool {
 	switch value.Kind() {
@@ -177,6 +176,9 @@ func parseRequest(v interface{}, r *http.Request, method string) map[string]inte
 	r.FormValue("")
 	m := make(map[string]interface{})
 	for _, f := range NewModel(v).Fields() {
+		if f.IsIgnore() || f.IsReadOnly() && (method == C || method == U) {
+			continue
+		}
 		_, ok := r.Form[f.DBName()]
 		if f.IsRequire(method) && !ok {
 			return nil
@@ -21,6 +21,7 @@ import (
 */
 type SQLRows struct {
 	rows *sql.Rows
+	cols []string
 	err  error
 }
 
@@ -1013,84 +1014,61 @@ func (r *SQLRows) String() string {
 }
 
 // Find 将结果查找后放到结构体中
+// v可以是*struct、*[]struct、*[]*struct，也可以是*int、*string、*[]int等，这时取每一行的第一列。
+// 结构体字段支持所有的int/uint/float、bool、string、[]byte、time.Time(按照TimeFormat解析)、
+// 指针(NULL的时候为nil)、sql.Null*以及实现了sql.Scanner的类型，转换失败的时候会返回错误。
 func (r *SQLRows) Find(v interface{}) error {
-	m := r.RowsMapInterface()
-	rv := reflect.ValueOf(v).Elem()
+	if r.err != nil {
+		return r.err
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return ErrMustBeAddr
+	}
+	if r.rows == nil {
+		return nil
+	}
+	defer r.rows.Close()
+	cols, err := r.rows.Columns()
+	if err != nil {
+		return err
+	}
+	rv = rv.Elem()
 	//如果查询是数组的话
-	if rv.Kind() == reflect.Slice {
-		for idx := range m {
-			elem := reflect.New(rv.Type().Elem())
-			for i := 0; i < elem.Elem().NumField(); i++ {
-				var dbn string
-				var field = elem.Elem().Type().Field(i)
-				var tagName = field.Tag.Get("dbname")
-				if tagName != "" {
-					dbn = tagName
-				} else {
-					dbn = ToDBName(field.Name)
-				}
-				dbv, ok := m[idx][dbn]
-				if ok && dbv != nil {
-					r.setValue(elem.Elem().Field(i), dbv)
-				}
-			}
-			rv.Set(reflect.Append(rv, elem.Elem()))
+	if rv.Kind() == reflect.Slice && rv.Type().Elem().Kind() != reflect.Uint8 {
+		elemType := rv.Type().Elem()
+		isPtr := elemType.Kind() == reflect.Ptr
+		if isPtr {
+			elemType = elemType.Elem()
 		}
-
-	} else {
-		//查询的是一个结构体或者是一个int,一个string
-		//以后如果只是一个结果的话，支持ToInt/ToString/ToInterface
-		//这里的int要去除掉
-		if len(m) >= 1 {
-			switch rv.Kind() {
-			case reflect.Struct:
-				elem := reflect.ValueOf(v).Elem()
-				for i := 0; i < elem.NumField(); i++ {
-					var dbn string
-					var field = elem.Type().Field(i)
-					var tagName = field.Tag.Get("dbname")
-					if tagName != "" {
-						dbn = tagName
-					} else {
-						dbn = ToDBName(field.Name)
-					}
-					dbv, ok := m[0][dbn]
-					if ok && dbv != nil {
-						r.setValue(elem.Field(i), dbv)
-					}
-				}
-			case reflect.Int, reflect.Int64:
-				for _, v := range m[0] {
-					str, ok := v.(string)
-					if ok {
-						val, err := strconv.Atoi(str)
-						if err == nil {
-							r.setValue(rv, val)
-						}
-					}
-				}
-			default:
-				for _, v := range m[0] {
-					r.setValue(rv, v)
-				}
+		for r.rows.Next() {
+			vals, err := scanValues(r.rows, len(cols))
+			if err != nil {
+				return err
+			}
+			elem := reflect.New(elemType)
+			if err := setRow(elem.Elem(), cols, vals); err != nil {
+				return err
+			}
+			if isPtr {
+				rv.Set(reflect.Append(rv, elem))
+			} else {
+				rv.Set(reflect.Append(rv, elem.Elem()))
 			}
 		}
+		return r.rows.Err()
 	}
-	return nil
-}
-
-func (r *SQLRows) setValue(v reflect.Value, i interface{}) {
-	if i != nil && v.Interface() != nil {
-		switch v.Kind() {
-		case reflect.Int:
-			v.Set(reflect.ValueOf(Int(i)))
-		case reflect.String:
-			v.Set(reflect.ValueOf(String(i)))
-		default:
-			v.Set(reflect.ValueOf(i))
+	//查询的是一个结构体或者是一个int,一个string
+	if r.rows.Next() {
+		vals, err := scanValues(r.rows, len(cols))
+		if err != nil {
+			return err
+		}
+		if err := setRow(rv, cols, vals); err != nil {
+			return err
 		}
-
 	}
+	return r.rows.Err()
 }
 
 // Scan 当只需要一列中的一个数据是可以使用Scan,比如 select count(*) from tablename
@@ -1,6 +1,10 @@
 package crud
 
 import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
 	"strconv"
 	"testing"
 )
@@ -94,3 +98,161 @@ func TestRowsMap_MultiWarpByField(t *testing.T) {
 		})
 	}
 }
+
+func TestRowsMap_WriteCSV(t *testing.T) {
+	rm := RowsMap{
+		RowMap{"id": "1", "name": "张三", "remark": `say "hi", ok`},
+		RowMap{"id": "2", "name": "李四"},
+	}
+	var buf bytes.Buffer
+	if err := rm.WriteCSV(&buf, []string{"id", "name", "remark"}, []string{"编号", "姓名", "备注"}); err != nil {
+		t.Fatal(err)
+	}
+	want := "编号,姓名,备注\n1,张三,\"say \"\"hi\"\", ok\"\n2,李四,\n"
+	if buf.String() != want {
+		t.Errorf("RowsMap.WriteCSV() = %q, want %q", buf.String(), want)
+	}
+
+	buf.Reset()
+	if err := rm.WriteNDJSON(&buf, []string{"name", "id"}); err != nil {
+		t.Fatal(err)
+	}
+	want = "{\"name\":\"张三\",\"id\":\"1\"}\n{\"name\":\"李四\",\"id\":\"2\"}\n"
+	if buf.String() != want {
+		t.Errorf("RowsMap.WriteNDJSON() = %q, want %q", buf.String(), want)
+	}
+}
+
+func TestRow(t *testing.T) {
+	rc := newRowColumns([]string{"id", "name", "deleted_at"})
+	rs := Rows{
+		Row{cols: rc, values: []string{"1", "", ""}, nulls: []bool{false, false, true}},
+	}
+	if rs[0].IsNull("name") || !rs[0].IsNull("deleted_at") || !rs[0].IsNull("other") {
+		t.Fatal("Row.IsNull() wrong")
+	}
+	bs, err := json.Marshal(rs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `[{"id":"1","name":"","deleted_at":null}]`; string(bs) != want {
+		t.Errorf("json.Marshal(Rows) = %s, want %s", bs, want)
+	}
+	if rm := rs.RowsMap(); rm[0]["deleted_at"] != "" || len(rm[0]) != 3 {
+		t.Errorf("Rows.RowsMap() = %v", rm)
+	}
+}
+
+func TestSQLRows_Rows(t *testing.T) {
+	db, fdb := newFakeDataBase(t, map[string][]string{"user": {"id", "name", "deleted_at"}})
+	var rowsErr error
+	fdb.query = func(query string, args []driver.Value) (*fakeRows, error) {
+		rows := newFakeRows([]string{"id", "name", "deleted_at"},
+			[]driver.Value{int64(1), []byte(""), nil},
+			[]driver.Value{int64(2), []byte("b"), []byte("2021-01-01")},
+		)
+		rows.err = rowsErr
+		return rows, nil
+	}
+	rs, err := db.Table("user").Rows()
+	if err != nil || len(rs) != 2 || !rs[0].IsNull("deleted_at") || rs[0].IsNull("name") || rs[1].String("name") != "b" {
+		t.Fatalf("Rows() = %v %v", rs, err)
+	}
+	if cols := rs[1].Columns(); len(cols) != 3 || cols[2] != "deleted_at" {
+		t.Fatalf("Row.Columns() = %v", cols)
+	}
+
+	rowsErr = errors.New("connection reset")
+	sr := db.Query("SELECT * FROM user")
+	rs, err = sr.Rows()
+	if err != rowsErr || sr.Err() != rowsErr || len(rs) != 2 {
+		t.Fatalf("Rows() with rows error = %d rows %v, Err() = %v", len(rs), err, sr.Err())
+	}
+	if fdb.openRows() != 0 {
+		t.Fatalf("Rows() left %d rows open", fdb.openRows())
+	}
+}
+
+func TestRowsMap_Join(t *testing.T) {
+	users := RowsMap{
+		RowMap{"id": "1", "name": "tom"},
+		RowMap{"id": "2", "name": "jerry"},
+	}
+	orders := RowsMap{
+		RowMap{"id": "10", "user_id": "1", "amount": "5"},
+		RowMap{"id": "11", "user_id": "1", "amount": "6"},
+	}
+	left := users.LeftJoin(orders, "id", "user_id", "order_")
+	want := `[{"id":"1","name":"tom","order_amount":"5","order_id":"10","order_user_id":"1"},{"id":"1","name":"tom","order_amount":"6","order_id":"11","order_user_id":"1"},{"id":"2","name":"jerry","order_amount":"","order_id":"","order_user_id":""}]`
+	if got := stringify(left); got != want {
+		t.Errorf("RowsMap.LeftJoin() = %s, want %s", got, want)
+	}
+	if inner := users.InnerJoin(orders, "id", "user_id", "order_"); len(inner) != 2 {
+		t.Errorf("RowsMap.InnerJoin() = %v", inner)
+	}
+	nest := users.Nest(orders, "id", "user_id", "orders")
+	want = `[{"id":"1","name":"tom","orders":[{"amount":"5","id":"10","user_id":"1"},{"amount":"6","id":"11","user_id":"1"}]},{"id":"2","name":"jerry","orders":[]}]`
+	if got := stringify(nest); got != want {
+		t.Errorf("RowsMap.Nest() = %s, want %s", got, want)
+	}
+}
+
+func TestRowsMap_Aggregate(t *testing.T) {
+	rm := RowsMap{
+		RowMap{"store": "a", "amount": "0.10", "user": "1"},
+		RowMap{"store": "a", "amount": "0.20", "user": "1"},
+		RowMap{"store": "b", "amount": "", "user": "2"},
+		RowMap{"store": "a", "amount": "10", "user": "3"},
+	}
+	got := rm.Aggregate([]string{"store"},
+		Agg{Func: AggCount},
+		Agg{Func: AggSum, Field: "amount"},
+		Agg{Func: AggAvg, Field: "amount", As: "avg"},
+		Agg{Func: AggMax, Field: "amount"},
+		Agg{Func: AggCountDistinct, Field: "user"},
+		Agg{Func: AggLast, Field: "user"},
+	)
+	want := `[{"avg":"3.433333","count":"3","count_distinct_user":"2","last_user":"3","max_amount":"10","store":"a","sum_amount":"10.30"},{"avg":"","count":"1","count_distinct_user":"1","last_user":"2","max_amount":"","store":"b","sum_amount":""}]`
+	if stringify(got) != want {
+		t.Errorf("RowsMap.Aggregate() = %s, want %s", stringify(got), want)
+	}
+	if total := rm.Aggregate(nil, Agg{Func: AggSum, Field: "amount", As: "total"}); len(total) != 1 || total[0]["total"] != "10.30" {
+		t.Errorf("RowsMap.Aggregate() total = %v", total)
+	}
+}
+
+func TestRowsMap_Tree(t *testing.T) {
+	rm := RowsMap{
+		RowMap{"id": "1", "parent_id": "0", "sort": "2"},
+		RowMap{"id": "2", "parent_id": "1", "sort": "10"},
+		RowMap{"id": "3", "parent_id": "1", "sort": "9"},
+		RowMap{"id": "4", "parent_id": "0", "sort": "1"},
+	}
+	tree, err := rm.Tree("id", "parent_id", "children", TreeOption{SortField: "sort", DepthKey: "depth", PathKey: "path"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `[{"children":[],"depth":0,"id":"4","parent_id":"0","path":"4","sort":"1"},{"children":[{"children":[],"depth":1,"id":"3","parent_id":"1","path":"1/3","sort":"9"},{"children":[],"depth":1,"id":"2","parent_id":"1","path":"1/2","sort":"10"}],"depth":0,"id":"1","parent_id":"0","path":"1","sort":"2"}]`
+	if stringify(tree) != want {
+		t.Errorf("RowsMap.Tree() = %s, want %s", stringify(tree), want)
+	}
+
+	rm = append(rm, RowMap{"id": "5", "parent_id": "6"}, RowMap{"id": "6", "parent_id": "5"})
+	if _, err := rm.Tree("id", "parent_id", "children"); !errors.Is(err, ErrTreeCycle) {
+		t.Errorf("RowsMap.Tree() err = %v, want ErrTreeCycle", err)
+	}
+}
+
+func TestRowsMap_Pivot(t *testing.T) {
+	rm := RowsMap{
+		RowMap{"store": "a", "month": "2021-02", "amount": "1.5"},
+		RowMap{"store": "a", "month": "2021-01", "amount": "2"},
+		RowMap{"store": "a", "month": "2021-01", "amount": "3"},
+		RowMap{"store": "b", "month": "2021-02", "amount": "4"},
+	}
+	got := rm.Pivot("store", "month", "amount", AggSum, PivotOption{Fill: "0", RowTotal: true, ColTotal: true})
+	want := `{"row_key":"store","columns":["2021-01","2021-02","total"],"rows":[{"2021-01":"5","2021-02":"1.5","store":"a","total":"6.5"},{"2021-01":"0","2021-02":"4","store":"b","total":"4"},{"2021-01":"5","2021-02":"5.5","store":"total","total":"10.5"}]}`
+	if stringify(got) != want {
+		t.Errorf("RowsMap.Pivot() = %s, want %s", stringify(got), want)
+	}
+}
@@ -0,0 +1,167 @@
+package crud
+
+import (
+	"bytes"
+	"database/sql"
+	"io"
+)
+
+// Row 保持SELECT列顺序并且能区分NULL和空字符串的单行结果
+type Row struct {
+	cols   *rowColumns
+	values []string
+	nulls  []bool // NULL位图，true为NULL
+}
+
+// Rows 多行Row，同一次查询的所有Row共用列名
+type Rows []Row
+
+type rowColumns struct {
+	names []string
+	index map[string]int
+}
+
+func newRowColumns(cols []string) *rowColumns {
+	rc := &rowColumns{names: cols, index: make(map[string]int, len(cols))}
+	for i, col := range cols {
+		// 同名的列(比如JOIN后的id)以第一个为准，和SELECT中的顺序一致
+		if _, ok := rc.index[col]; !ok {
+			rc.index[col] = i
+		}
+	}
+	return rc
+}
+
+// Columns 列名，按照SELECT的顺序
+func (r Row) Columns() []string {
+	if r.cols == nil {
+		return nil
+	}
+	return r.cols.names
+}
+
+// Values 所有的值，按照SELECT的顺序，NULL为""
+func (r Row) Values() []string {
+	return r.values
+}
+
+// Len 列数
+func (r Row) Len() int {
+	return len(r.values)
+}
+
+// Has 是否有这个字段
+func (r Row) Has(field string) bool {
+	if r.cols == nil {
+		return false
+	}
+	_, ok := r.cols.index[field]
+	return ok
+}
+
+// Get 获取字段的值，字段不存在或者为NULL时ok为false
+func (r Row) Get(field string) (string, bool) {
+	if r.cols == nil {
+		return "", false
+	}
+	i, ok := r.cols.index[field]
+	if !ok || r.nulls[i] {
+		return "", false
+	}
+	return r.values[i], true
+}
+
+// String 获取字段的值，字段不存在或者为NULL时为""
+func (r Row) String(field string) string {
+	val, _ := r.Get(field)
+	return val
+}
+
+// IsNull 字段是否为NULL，字段不存在的时候也返回true
+func (r Row) IsNull(field string) bool {
+	if r.cols == nil {
+		return true
+	}
+	i, ok := r.cols.index[field]
+	return !ok || r.nulls[i]
+}
+
+// RowMap 转换成RowMap，NULL会变成""
+func (r Row) RowMap() RowMap {
+	rm := make(RowMap, len(r.values))
+	for i, col := range r.Columns() {
+		if _, ok := rm[col]; !ok {
+			rm[col] = r.values[i]
+		}
+	}
+	return rm
+}
+
+// MarshalJSON 按照SELECT的顺序输出，NULL输出为null
+func (r Row) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	r.writeJSON(&buf)
+	return buf.Bytes(), nil
+}
+
+func (r Row) writeJSON(buf *bytes.Buffer) {
+	buf.WriteByte('{')
+	for i, col := range r.Columns() {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		writeJSONString(buf, col)
+		buf.WriteByte(':')
+		if r.nulls[i] {
+			buf.WriteString("null")
+		} else {
+			writeJSONString(buf, r.values[i])
+		}
+	}
+	buf.WriteByte('}')
+}
+
+// RowsMap 转换成RowsMap，NULL会变成""
+func (rs Rows) RowsMap() RowsMap {
+	rm := make(RowsMap, 0, len(rs))
+	for _, r := range rs {
+		rm = append(rm, r.RowMap())
+	}
+	return rm
+}
+
+// WriteNDJSON 每行写一个JSON对象，字段顺序和SELECT一致，NULL为null。
+func (rs Rows) WriteNDJSON(w io.Writer) error {
+	var buf bytes.Buffer
+	for _, r := range rs {
+		buf.Reset()
+		r.writeJSON(&buf)
+		buf.WriteByte('\n')
+		if _, err := w.Write(buf.Bytes()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Rows 返回保持列顺序和NULL的结果，查询或者遍历出错的时候返回已经读取的行和这个错误。
+func (r *SQLRows) Rows() (Rows, error) {
+	rs := make(Rows, 0) //为了JSON输出的时候为[]
+	var rc *rowColumns
+	err := r.eachRaw(func(cols []string, raws []sql.RawBytes) error {
+		if rc == nil {
+			rc = newRowColumns(cols)
+		}
+		row := Row{cols: rc, values: make([]string, len(raws)), nulls: make([]bool, len(raws))}
+		for i, raw := range raws {
+			row.values[i] = string(raw)
+			row.nulls[i] = raw == nil
+		}
+		rs = append(rs, row)
+		return nil
+	})
+	if err != nil {
+		r.err = err
+	}
+	return rs, err
+}
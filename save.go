@@ -0,0 +1,421 @@
+package crud
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// 级联保存
+// Create、Update会在同一个事务中保存结构体中声明的关联(见association.go)：
+//	1. 先保存belongs_to的结构体，再把它的主键填到本结构体的外键中
+//	2. 保存本结构体
+//	3. 把本结构体的主键填到has_one、has_many结构体的外键中，再保存这些结构体
+//	4. 保存many2many的结构体，再同步中间表，中间表中多余的行会被删除
+// 关联的结构体主键为零值或者数据库中没有这一行的时候创建，否则更新。nil的指针、零值的结构体、nil的slice不会被保存，
+// 空的many2many slice会清空中间表。has_many中被去掉的结构体不会被删除。
+// 使用Associations可以只保存指定的关联，SkipAssociations不保存任何关联。
+
+// SkipAssociations 返回一个不查询、不保存任何关联的DataBase，等同于Associations()。
+func (db *DataBase) SkipAssociations() *DataBase {
+	return db.Associations()
+}
+
+// saver 一次Create、Update的状态
+type saver struct {
+	cascade bool
+	visited map[visitKey]bool // 已经保存过的结构体，防止循环引用
+	filled  []reflect.Value   // 回填了自增主键的字段，回滚的时候清空
+	updated []reflect.Value   // 更新了的结构体，提交之后更新版本号和Snapshot
+}
+
+type visitKey struct {
+	ptr uintptr
+	typ reflect.Type
+}
+
+func newSaver(cascade bool) *saver {
+	return &saver{cascade: cascade, visited: map[visitKey]bool{}}
+}
+
+// visit 标记结构体v(指针)，已经标记过的时候返回true。
+func (s *saver) visit(v reflect.Value) bool {
+	key := visitKey{v.Pointer(), v.Type()}
+	if s.visited[key] {
+		return true
+	}
+	s.visited[key] = true
+	return false
+}
+
+// finish Create、Update结束之后调用，err为执行的结果。
+// 在调用者的事务中的时候，版本号和Snapshot在事务提交之后才更新，事务回滚的时候清空回填的自增主键。
+func (s *saver) finish(db *DataBase, err error) {
+	if err != nil {
+		s.rollback()
+		return
+	}
+	db.afterTx(func() { s.commit(db) }, s.rollback)
+}
+
+// rollback 回滚了就不应该有ID
+func (s *saver) rollback() {
+	for _, f := range s.filled {
+		f.Set(reflect.Zero(f.Type()))
+	}
+}
+
+// commit 提交之后更新结构体中的版本号，重新记录Snapshot
+func (s *saver) commit(db *DataBase) {
+	for _, v := range s.updated {
+		ms := getModel(v.Type())
+		if f, ok := ms.byColumn[db.versionColumn]; ok && db.tableColumns[getStructDBName(v)].HaveColumn(db.versionColumn) {
+			fv := v.Elem().FieldByIndex(f.index)
+			switch fv.Kind() {
+			case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+				fv.SetInt(fv.Int() + 1)
+			case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+				fv.SetUint(fv.Uint() + 1)
+			}
+		}
+		if _, tracked := ms.dirtyColumns(v); tracked {
+			ms.takeSnapshot(v)
+		}
+	}
+}
+
+// needTx 保存结构体v(指针)是否需要事务：有钩子或者有需要级联保存的关联的时候需要。
+func (s *saver) needTx(db *DataBase, v reflect.Value, hooks ...string) bool {
+	if db.hasHook(v, hooks...) {
+		return true
+	}
+	return s.cascade && len(db.relationFields(getModel(v.Type()))) > 0
+}
+
+// create 创建结构体v(指针)以及它的关联
+func (s *saver) create(tx *DataBase, v reflect.Value) (int64, error) {
+	if s.visit(v) {
+		return 0, nil
+	}
+	if err := s.saveBelongsTo(tx, v); err != nil {
+		return 0, err
+	}
+	id, err := s.createOne(tx, v)
+	if err != nil {
+		return id, err
+	}
+	return id, s.saveChildren(tx, v)
+}
+
+// update 更新结构体v(指针)以及它的关联
+// insertMissing为true的时候，没有更新到任何行并且数据库中没有这一行的时候会创建这个结构体。
+func (s *saver) update(tx *DataBase, v reflect.Value, columns func(ms *modelStruct, v reflect.Value) ([]string, error), insertMissing bool) error {
+	if s.visit(v) {
+		return nil
+	}
+	if err := s.saveBelongsTo(tx, v); err != nil {
+		return err
+	}
+	noRows, err := s.updateOne(tx, v, columns)
+	// 使用乐观锁的时候数据库中没有这一行也会返回ErrStaleObject
+	stale := errors.Is(err, ErrStaleObject)
+	if err != nil && !(stale && insertMissing) {
+		return err
+	}
+	if noRows || stale {
+		if err := s.updatedNoRows(tx, v, insertMissing, stale); err != nil {
+			return err
+		}
+	}
+	return s.saveChildren(tx, v)
+}
+
+// updatedNoRows UPDATE没有影响任何行的时候调用，stale为true表示版本号不匹配。
+// MySQL中值没有变化的时候影响的行数也是0，所以insertMissing的时候需要确认数据库中没有这一行才创建。
+func (s *saver) updatedNoRows(tx *DataBase, v reflect.Value, insertMissing, stale bool) error {
+	if insertMissing {
+		exists, err := rowExists(tx, v)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			_, err = s.createOne(tx, v)
+			return err
+		}
+	}
+	if stale {
+		return ErrStaleObject
+	}
+	s.updated = append(s.updated, v)
+	return tx.callHook(v, AfterUpdate)
+}
+
+// saveRelated 保存关联的结构体，主键为零值或者数据库中没有这一行的时候创建，否则更新。
+func (s *saver) saveRelated(tx *DataBase, v reflect.Value) error {
+	pks, _ := getModel(v.Type()).primaryKeys(tx.tableColumns[getStructDBName(v)])
+	if _, err := pkMap(v, pks); err != nil {
+		_, err = s.create(tx, v)
+		return err
+	}
+	return s.update(tx, v, changedColumns, true)
+}
+
+// rowExists 数据库中是否有结构体v(指针)主键对应的行
+func rowExists(tx *DataBase, v reflect.Value) (bool, error) {
+	table := tx.Table(getStructDBName(v))
+	pks, _ := getModel(v.Type()).primaryKeys(table.Columns)
+	keys, err := pkMap(v, pks)
+	if err != nil {
+		return false, err
+	}
+	cols := pkColumns(pks)
+	conds := make([]string, len(cols))
+	args := make([]interface{}, len(cols))
+	for i, col := range cols {
+		conds[i] = "`" + col + "` = ?"
+		args[i] = keys[col]
+	}
+	rows := tx.Query(fmt.Sprintf("SELECT COUNT(1) FROM `%s` WHERE %s", table.tableName, strings.Join(conds, " AND ")), args...)
+	if rows.err != nil {
+		return false, rows.err
+	}
+	return rows.Int() > 0, nil
+}
+
+// createOne 只创建结构体v本身
+func (s *saver) createOne(tx *DataBase, v reflect.Value) (int64, error) {
+	// 这里的处理应该是有才处理，没有不管。
+	if err := tx.callHook(v, BeforeCreate); err != nil {
+		return 0, err
+	}
+	table := tx.Table(getStructDBName(v))
+	m, autoField := createMap(v, table)
+	id, err := table.Create(m)
+	if err != nil {
+		return id, err
+	}
+	if autoField.IsValid() {
+		if err := assignValue(autoField, id); err != nil {
+			return id, err
+		}
+		s.filled = append(s.filled, autoField)
+	}
+	return id, tx.callHook(v, AfterCreate)
+}
+
+// updateOne 只更新结构体v本身，见DataBase.update。
+// 执行了UPDATE但是没有影响任何行的时候noRows为true，这时不会调用AfterUpdate，由调用者处理。
+func (s *saver) updateOne(tx *DataBase, v reflect.Value, columns func(ms *modelStruct, v reflect.Value) ([]string, error)) (noRows bool, err error) {
+	if err := tx.callHook(v, BeforeUpdate); err != nil {
+		return false, err
+	}
+	ms := getModel(v.Type())
+	table := tx.Table(getStructDBName(v))
+	pks, _ := ms.primaryKeys(table.Columns)
+	keys, err := pkMap(v, pks)
+	if err != nil {
+		return false, err
+	}
+	cols, err := columns(ms, v.Elem())
+	if err != nil {
+		return false, err
+	}
+	var m map[string]interface{}
+	if cols == nil {
+		m = ms.toMap(v, true, false)
+	} else {
+		all := ms.toMap(v, false, false)
+		m = make(map[string]interface{}, len(cols)+len(keys)+1)
+		for _, col := range cols {
+			if _, isKey := keys[col]; !isKey && !ms.byColumn[col].readOnly {
+				m[col] = all[col]
+			}
+		}
+		if len(m) == 0 {
+			return false, nil
+		}
+		// 乐观锁的版本号作为条件
+		if val, ok := all[tx.versionColumn]; ok {
+			m[tx.versionColumn] = val
+		}
+	}
+	for k, val := range keys {
+		m[k] = val
+	}
+	n, err := table.update(m, pkColumns(pks)...)
+	if err != nil {
+		return false, err
+	}
+	if n == 0 {
+		return true, nil
+	}
+	s.updated = append(s.updated, v)
+	return false, tx.callHook(v, AfterUpdate)
+}
+
+// saveBelongsTo 保存belongs_to的结构体，并填入本结构体的外键。
+func (s *saver) saveBelongsTo(tx *DataBase, v reflect.Value) error {
+	if !s.cascade {
+		return nil
+	}
+	ms := getModel(v.Type())
+	elem := v.Elem()
+	for _, f := range tx.relationFields(ms) {
+		if f.rel.kind != BelongsTo {
+			continue
+		}
+		targets := relatedPtrs(elem.FieldByIndex(f.index))
+		if len(targets) == 0 {
+			continue
+		}
+		if err := s.saveRelated(tx, targets[0]); err != nil {
+			return err
+		}
+		fk, ref := tx.relationKeys(ms.typ, f.rel)
+		of, ok := ms.byColumn[fk]
+		rf, ok2 := getModel(f.rel.elem).byColumn[ref]
+		if !ok || !ok2 {
+			return fmt.Errorf("%w: %s.%s 列%s或%s不存在", ErrAssociation, ms.typ.Name(), f.name, fk, ref)
+		}
+		if err := assignValue(elem.FieldByIndex(of.index), driverValue(targets[0].Elem().FieldByIndex(rf.index))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// saveChildren 保存has_one、has_many、many2many的结构体
+func (s *saver) saveChildren(tx *DataBase, v reflect.Value) error {
+	if !s.cascade {
+		return nil
+	}
+	ms := getModel(v.Type())
+	elem := v.Elem()
+	for _, f := range tx.relationFields(ms) {
+		rel := f.rel
+		if rel.kind == BelongsTo {
+			continue
+		}
+		field := elem.FieldByIndex(f.index)
+		children := relatedPtrs(field)
+		if len(children) == 0 && (rel.kind != Many2Many || field.Kind() != reflect.Slice || field.IsNil()) {
+			continue
+		}
+		ownKey, targetKey := tx.relationKeys(ms.typ, rel)
+		of, ok := ms.byColumn[ownKey]
+		if !ok {
+			return fmt.Errorf("%w: %s.%s 列%s不存在", ErrAssociation, ms.typ.Name(), f.name, ownKey)
+		}
+		ownVal := driverValue(elem.FieldByIndex(of.index))
+		if ownVal == nil || isBlank(reflect.Indirect(elem.FieldByIndex(of.index))) {
+			return ErrMustNeedID
+		}
+		if rel.kind != Many2Many {
+			cf, ok := getModel(rel.elem).byColumn[targetKey]
+			if !ok {
+				return fmt.Errorf("%w: %s 列%s不存在", ErrAssociation, rel.elem.Name(), targetKey)
+			}
+			for _, child := range children {
+				if err := assignValue(child.Elem().FieldByIndex(cf.index), ownVal); err != nil {
+					return err
+				}
+				if err := s.saveRelated(tx, child); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		_, targetTable := relationTables(ms.typ, rel)
+		pk := tx.pkColumn(rel.elem, targetTable)
+		pf, ok := getModel(rel.elem).byColumn[pk]
+		if !ok {
+			return fmt.Errorf("%w: %s 列%s不存在", ErrAssociation, rel.elem.Name(), pk)
+		}
+		refs := make([]interface{}, 0, len(children))
+		for _, child := range children {
+			if err := s.saveRelated(tx, child); err != nil {
+				return err
+			}
+			refs = append(refs, driverValue(child.Elem().FieldByIndex(pf.index)))
+		}
+		if err := syncJoinTable(tx, rel, ownVal, refs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// syncJoinTable 使中间表中ownVal对应的行和refs一致，插入没有的，删除多余的。
+func syncJoinTable(tx *DataBase, rel *relation, ownVal interface{}, refs []interface{}) error {
+	query, args := tx.Table(rel.joinTable).Fields("`"+rel.joinReferences+"`").Where("`"+rel.joinForeignKey+"` = ?", ownVal).Parse()
+	rows := tx.Query(query, args...)
+	if rows.err != nil {
+		return rows.err
+	}
+	existing := map[string]bool{}
+	for _, r := range rows.RowsMap() {
+		existing[r[rel.joinReferences]] = true
+	}
+	want := map[string]bool{}
+	adds := []map[string]interface{}{}
+	for _, ref := range refs {
+		k := keyString(reflect.ValueOf(ref))
+		if want[k] {
+			continue
+		}
+		want[k] = true
+		if !existing[k] {
+			adds = append(adds, map[string]interface{}{rel.joinForeignKey: ownVal, rel.joinReferences: ref})
+		}
+	}
+	removes := []string{}
+	for k := range existing {
+		if !want[k] {
+			removes = append(removes, k)
+		}
+	}
+	if len(adds) > 0 {
+		if _, err := tx.Table(rel.joinTable).Creates(adds); err != nil {
+			return err
+		}
+	}
+	if len(removes) == 0 {
+		return nil
+	}
+	sort.Strings(removes)
+	args = []interface{}{ownVal}
+	for _, k := range removes {
+		args = append(args, k)
+	}
+	_, err := tx.Exec(fmt.Sprintf("DELETE FROM `%s` WHERE `%s` = ? AND `%s` IN (%s)", rel.joinTable, rel.joinForeignKey, rel.joinReferences, argslice(len(removes))), args...).RowsAffected()
+	return err
+}
+
+// relatedPtrs 关联字段中需要保存的结构体指针，nil的指针和零值的结构体会被忽略。
+func relatedPtrs(field reflect.Value) []reflect.Value {
+	out := []reflect.Value{}
+	switch field.Kind() {
+	case reflect.Slice:
+		for i := 0; i < field.Len(); i++ {
+			ev := field.Index(i)
+			if ev.Kind() == reflect.Ptr {
+				if !ev.IsNil() {
+					out = append(out, ev)
+				}
+				continue
+			}
+			out = append(out, ev.Addr())
+		}
+	case reflect.Ptr:
+		if !field.IsNil() {
+			out = append(out, field)
+		}
+	case reflect.Struct:
+		if !field.IsZero() {
+			out = append(out, field.Addr())
+		}
+	}
+	return out
+}
@@ -0,0 +1,191 @@
+package crud
+
+import (
+	"database/sql/driver"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRelatedPtrs(t *testing.T) {
+	a := AssocArticle{
+		Writer: &AssocWriter{ID: 1},
+		Notes:  []AssocNote{{ID: 2}, {}},
+		Labels: []*AssocLabel{nil, {ID: 3}},
+	}
+	v := reflect.ValueOf(&a).Elem()
+	ms := getModel(v.Type())
+	counts := map[string]int{}
+	for _, f := range ms.relations {
+		counts[f.name] = len(relatedPtrs(v.FieldByIndex(f.index)))
+	}
+	if want := map[string]int{"Writer": 1, "Notes": 2, "Labels": 1, "Cover": 0}; !reflect.DeepEqual(counts, want) {
+		t.Fatalf("relatedPtrs() = %v, want %v", counts, want)
+	}
+	notes := relatedPtrs(v.FieldByIndex(ms.byName["Notes"].index))
+	notes[1].Elem().FieldByName("ID").SetInt(5)
+	if a.Notes[1].ID != 5 {
+		t.Fatal("relatedPtrs() should point into the slice")
+	}
+
+	s := newSaver(true)
+	if s.visit(reflect.ValueOf(&a)) || !s.visit(reflect.ValueOf(&a)) {
+		t.Fatal("visit() should report visited structs")
+	}
+	db := newTestDataBase(nil)
+	if fields := db.SkipAssociations().relationFields(ms); len(fields) != 0 {
+		t.Fatalf("SkipAssociations() relationFields = %d", len(fields))
+	}
+	if fields := db.relationFields(ms); len(fields) != 4 {
+		t.Fatalf("relationFields() = %d", len(fields))
+	}
+}
+
+type SavePost struct {
+	ID       int64
+	Version  int
+	Title    string
+	Comments []SaveComment `crud:"has_many"`
+}
+
+type SaveComment struct {
+	ID         int64
+	SavePostID int64
+	Body       string
+}
+
+func newSaveDataBase(t *testing.T) (*DataBase, *fakeDB) {
+	db, fdb := newFakeDataBase(t, map[string][]string{
+		"save_post":    {"id", "version", "title"},
+		"save_comment": {"id", "save_post_id", "body"},
+	})
+	for _, table := range []string{"save_post", "save_comment"} {
+		id := db.tableColumns[table]["id"]
+		id.Key, id.Extra = "PRI", "auto_increment"
+		db.tableColumns[table]["id"] = id
+	}
+	db.OptimisticLock()
+	fdb.exec = func(query string, args []driver.Value) (driver.Result, error) {
+		// id为9的评论在数据库中不存在
+		if strings.HasPrefix(query, "UPDATE `save_comment`") && args[len(args)-1] == int64(9) {
+			return fakeResult{}, nil
+		}
+		return fakeResult{id: 100, affected: 1}, nil
+	}
+	fdb.query = func(query string, args []driver.Value) (*fakeRows, error) {
+		return newFakeRows([]string{"COUNT(1)"}, []driver.Value{int64(0)}), nil
+	}
+	return db, fdb
+}
+
+func TestSaveMissingChild(t *testing.T) {
+	db, fdb := newSaveDataBase(t)
+	post := &SavePost{ID: 1, Version: 2, Title: "t", Comments: []SaveComment{{ID: 1, Body: "a"}, {ID: 9, Body: "b"}, {Body: "c"}}}
+	if err := db.Update(post); err != nil {
+		t.Fatal(err)
+	}
+	var inserts, exists int
+	for i, stmt := range fdb.statements() {
+		switch {
+		case strings.HasPrefix(stmt, "INSERT INTO `save_comment`"):
+			inserts++
+		case strings.HasPrefix(stmt, "SELECT COUNT(1) FROM `save_comment`"):
+			exists++
+			if !reflect.DeepEqual(fdb.args[i], []driver.Value{int64(9)}) {
+				t.Fatalf("rowExists() args = %v", fdb.args[i])
+			}
+		}
+	}
+	if inserts != 2 || exists != 1 {
+		t.Fatalf("Update() inserted %d comments and checked %d: %v", inserts, exists, fdb.statements())
+	}
+	if post.Version != 3 || post.Comments[1].ID != 9 || post.Comments[2].ID != 100 || post.Comments[2].SavePostID != 1 {
+		t.Fatalf("Update() = %+v", post)
+	}
+}
+
+func TestSaveInOuterTransaction(t *testing.T) {
+	db, _ := newSaveDataBase(t)
+	errAbort := errors.New("abort")
+	post := &SavePost{ID: 1, Version: 5, Comments: []SaveComment{{Body: "c"}}}
+	err := db.Transaction(func(tx *DataBase) error {
+		if err := tx.Update(post); err != nil {
+			return err
+		}
+		if post.Version != 5 || post.Comments[0].ID != 100 {
+			t.Fatalf("Update() inside a transaction = %+v, want version 5 until commit", post)
+		}
+		return errAbort
+	})
+	if err != errAbort || post.Version != 5 || post.Comments[0].ID != 0 {
+		t.Fatalf("Update() after rollback = %v %+v, want version 5 and no comment id", err, post)
+	}
+
+	post.Comments[0] = SaveComment{Body: "c"}
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Update(post); err != nil || post.Version != 5 {
+		t.Fatalf("Update() inside Begin = %v, version %d", err, post.Version)
+	}
+	if err := tx.Commit(); err != nil || post.Version != 6 || post.Comments[0].ID != 100 {
+		t.Fatalf("Commit() = %v %+v, want version 6", err, post)
+	}
+}
+
+type SaveShop struct {
+	ID    int64
+	Name  string
+	Items []SaveItem `crud:"has_many"`
+}
+
+type SaveItem struct {
+	Code       string `db:"code,pk"`
+	SaveShopID int64
+	Version    int
+}
+
+func TestSaveMissingVersionedChild(t *testing.T) {
+	db, fdb := newFakeDataBase(t, map[string][]string{
+		"save_shop": {"id", "name"},
+		"save_item": {"code", "save_shop_id", "version"},
+	})
+	id := db.tableColumns["save_shop"]["id"]
+	id.Key, id.Extra = "PRI", "auto_increment"
+	db.tableColumns["save_shop"]["id"] = id
+	db.OptimisticLock()
+	fdb.exec = func(query string, args []driver.Value) (driver.Result, error) {
+		if strings.HasPrefix(query, "UPDATE `save_item`") {
+			return fakeResult{}, nil
+		}
+		return fakeResult{id: 100, affected: 1}, nil
+	}
+	count := int64(0)
+	fdb.query = func(query string, args []driver.Value) (*fakeRows, error) {
+		return newFakeRows([]string{"COUNT(1)"}, []driver.Value{count}), nil
+	}
+
+	shop := &SaveShop{Name: "s", Items: []SaveItem{{Code: "A-1"}}}
+	if _, err := db.Create(shop); err != nil {
+		t.Fatal(err)
+	}
+	stmts := fdb.statements()
+	if !strings.HasPrefix(stmts[len(stmts)-2], "INSERT INTO `save_item`") || stmts[len(stmts)-1] != "COMMIT" {
+		t.Fatalf("Create() = %v, want the item inserted", stmts)
+	}
+	if shop.ID != 100 || shop.Items[0].SaveShopID != 100 {
+		t.Fatalf("Create() = %+v", shop)
+	}
+
+	// 数据库中有这一行的时候是版本冲突
+	count = 1
+	shop = &SaveShop{Name: "s", Items: []SaveItem{{Code: "A-1", Version: 3}}}
+	if _, err := db.Create(shop); !errors.Is(err, ErrStaleObject) {
+		t.Fatalf("Create() with an existing item = %v, want %v", err, ErrStaleObject)
+	}
+	if stmts = fdb.statements(); stmts[len(stmts)-1] != "ROLLBACK" || shop.ID != 0 {
+		t.Fatalf("Create() with an existing item = %v %+v, want rollback", stmts, shop)
+	}
+}
@@ -2,6 +2,8 @@ package crud
 
 import (
 	"fmt"
+	"reflect"
+	"sort"
 	"strconv"
 	"strings"
 )
@@ -10,6 +12,7 @@ import (
 type JoinCon struct {
 	TableName string
 	Condition string
+	Inner     bool // INNER JOIN，默认为LEFT JOIN
 }
 
 // JoinCons join条件slice
@@ -31,6 +34,15 @@ type WhereCon struct {
 	Args  []interface{}
 }
 
+// WithCon WITH条件(CTE)
+// Recursive为true时Search为锚点部分，Union为递归部分，两者之间使用UNION ALL连接。
+type WithCon struct {
+	Name      string
+	Search    *Search
+	Union     *Search
+	Recursive bool
+}
+
 // Search 搜索结构体
 type Search struct {
 	table             *Table
@@ -41,7 +53,7 @@ type Search struct {
 	orderbyConditions []string
 	groupConditions   []string
 	havingConditions  []WhereCon
-	with              string
+	with              []WithCon
 	having            string
 	limit             interface{}
 	offset            interface{}
@@ -49,11 +61,20 @@ type Search struct {
 	query string
 	args  []interface{}
 	raw   bool
+	err   error // 构造条件时的错误，所有的结果函数都会返回这个错误
 }
 
 // Clone 克隆一个当前结构体
+// 条件的slice也会复制一份，避免克隆出来的Search在append的时候互相覆盖。
 func (s *Search) Clone() *Search {
 	clone := *s
+	clone.fields = append([]string(nil), s.fields...)
+	clone.joinConditions = append(JoinCons(nil), s.joinConditions...)
+	clone.whereConditions = append([]WhereCon(nil), s.whereConditions...)
+	clone.orderbyConditions = append([]string(nil), s.orderbyConditions...)
+	clone.groupConditions = append([]string(nil), s.groupConditions...)
+	clone.havingConditions = append([]WhereCon(nil), s.havingConditions...)
+	clone.with = append([]WithCon(nil), s.with...)
 	return &clone
 }
 
@@ -73,7 +94,13 @@ func (s *Search) Fields(args ...string) *Search {
 }
 
 // Where where语法
+// 如果只传入一个map或者结构体参数，则使用:name/@name命名参数，详见Named。
 func (s *Search) Where(query string, values ...interface{}) *Search {
+	query, values, err := namedArgs(query, values)
+	if err != nil {
+		s.setErr(err)
+		return s
+	}
 	s.whereConditions = append(s.whereConditions, WhereCon{Query: query, Args: values})
 	return s
 }
@@ -104,6 +131,164 @@ func (s *Search) NotIn(field string, args ...interface{}) *Search {
 	return s
 }
 
+// WhereStruct 使用结构体中非零值的字段作为条件，字段名规则和structToMap一样。
+// WhereStruct(&Order{UserID: 3, Status: 1}) => `order`.`user_id` = 3 AND `order`.`status` = 1
+func (s *Search) WhereStruct(obj interface{}) *Search {
+	v := reflect.Indirect(reflect.ValueOf(obj))
+	if v.Kind() != reflect.Struct {
+		return s
+	}
+	for _, f := range getModel(v.Type()).columns {
+		fv := v.FieldByIndex(f.index)
+		if isBlank(fv) {
+			continue
+		}
+		s.whereConditions = append(s.whereConditions, WhereCon{Query: fmt.Sprintf("`%s`.`%s` = ?", s.tableName, f.column), Args: []interface{}{fv.Interface()}})
+	}
+	return s
+}
+
+// WhereMap 使用map作为条件，key为"字段 操作符"，操作符默认为=。
+// 字段可以是"字段"或者"表名.字段"，没有表名的时候使用当前的表名。
+// 操作符只能是=、!=、<>、>、>=、<、<=、LIKE、NOT LIKE、IN、NOT IN、IS、IS NOT、BETWEEN、NOT BETWEEN，
+// 不支持的操作符或者字段名会作为Search的错误返回，详见Err。
+// 值为nil时使用IS NULL(!=、<>、NOT IN、IS NOT时为IS NOT NULL)，值为slice时使用IN(!=、<>时为NOT IN)，
+// BETWEEN的值必须是两个元素的slice。空的IN条件永远为假，空的NOT IN条件会被忽略。
+// WhereMap(map[string]interface{}{"age >": 18, "status IN": []int{1, 2}, "deleted_at": nil})
+func (s *Search) WhereMap(m map[string]interface{}) *Search {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	// map是无序的，排序后生成的SQL语句才是固定的。
+	sort.Strings(keys)
+	for _, k := range keys {
+		con, ok, err := whereMapCon(s.tableName, k, m[k])
+		if err != nil {
+			s.setErr(err)
+			return s
+		}
+		if ok {
+			s.whereConditions = append(s.whereConditions, con)
+		}
+	}
+	return s
+}
+
+// whereMapOps WhereMap支持的操作符
+var whereMapOps = map[string]bool{
+	"=": true, "!=": true, "<>": true, ">": true, ">=": true, "<": true, "<=": true,
+	"LIKE": true, "NOT LIKE": true, "IN": true, "NOT IN": true, "IS": true, "IS NOT": true,
+	"BETWEEN": true, "NOT BETWEEN": true,
+}
+
+// whereMapCon 将WhereMap中的一项转换成where条件，ok为false时忽略这个条件。
+func whereMapCon(tableName, key string, val interface{}) (con WhereCon, ok bool, err error) {
+	key = strings.TrimSpace(key)
+	name, op := key, "="
+	if idx := strings.IndexByte(key, ' '); idx > 0 {
+		name, op = key[:idx], strings.ToUpper(strings.Join(strings.Fields(key[idx+1:]), " "))
+	}
+	if !whereMapOps[op] {
+		return con, false, fmt.Errorf("%w: 不支持的操作符%q", ErrArgs, op)
+	}
+	field, err := quoteField(tableName, name)
+	if err != nil {
+		return con, false, err
+	}
+	var not bool
+	switch op {
+	case "!=", "<>", "NOT IN", "IS NOT":
+		not = true
+	}
+	if val == nil {
+		switch op {
+		case "=", "IN", "IS":
+			return WhereCon{Query: field + " IS NULL"}, true, nil
+		case "!=", "<>", "NOT IN", "IS NOT":
+			return WhereCon{Query: field + " IS NOT NULL"}, true, nil
+		}
+		return con, false, fmt.Errorf("%w: %s的值不能为nil", ErrArgs, key)
+	}
+	vals := expandNamedValue(val)
+	switch op {
+	case "IS", "IS NOT":
+		return con, false, fmt.Errorf("%w: %s的值只能为nil", ErrArgs, key)
+	case "BETWEEN", "NOT BETWEEN":
+		if len(vals) != 2 {
+			return con, false, fmt.Errorf("%w: %s的值必须是两个元素的slice", ErrArgs, key)
+		}
+		return WhereCon{Query: fmt.Sprintf("%s %s ? AND ?", field, op), Args: vals}, true, nil
+	}
+	if vals == nil {
+		if op == "IN" || op == "NOT IN" {
+			return WhereCon{Query: fmt.Sprintf("%s %s (?)", field, op), Args: []interface{}{val}}, true, nil
+		}
+		return WhereCon{Query: fmt.Sprintf("%s %s ?", field, op), Args: []interface{}{val}}, true, nil
+	}
+	switch op {
+	case "=", "!=", "<>", "IN", "NOT IN":
+	default:
+		return con, false, fmt.Errorf("%w: %s的值不能为slice", ErrArgs, key)
+	}
+	if len(vals) == 0 {
+		if not {
+			return con, false, nil
+		}
+		return WhereCon{Query: "1 = 0"}, true, nil
+	}
+	if not {
+		return WhereCon{Query: fmt.Sprintf("%s NOT IN (%s)", field, placeholder(len(vals))), Args: vals}, true, nil
+	}
+	return WhereCon{Query: fmt.Sprintf("%s IN (%s)", field, placeholder(len(vals))), Args: vals}, true, nil
+}
+
+// quoteField 将"字段"或者"表名.字段"转换成`表名`.`字段`，名字中只能有字母、数字和下划线。
+func quoteField(tableName, name string) (string, error) {
+	parts := strings.Split(name, ".")
+	if len(parts) == 1 {
+		parts = []string{tableName, parts[0]}
+	}
+	if len(parts) != 2 {
+		return "", fmt.Errorf("%w: 不支持的字段%q", ErrArgs, name)
+	}
+	for i, part := range parts {
+		part = strings.TrimSuffix(strings.TrimPrefix(part, "`"), "`")
+		if part == "" {
+			return "", fmt.Errorf("%w: 不支持的字段%q", ErrArgs, name)
+		}
+		for j := 0; j < len(part); j++ {
+			if !isNameChar(part[j]) {
+				return "", fmt.Errorf("%w: 不支持的字段%q", ErrArgs, name)
+			}
+		}
+		parts[i] = "`" + part + "`"
+	}
+	return strings.Join(parts, "."), nil
+}
+
+// Err 构造条件时的错误，比如命名参数缺失。
+// 有错误的时候不会执行查询，返回error的结果函数会返回这个错误，其他的结果函数返回零值。
+func (s *Search) Err() error {
+	return s.err
+}
+
+// setErr 记录第一个错误
+func (s *Search) setErr(err error) {
+	if s.err == nil {
+		s.err = err
+	}
+}
+
+// queryRows 执行查询，有构造条件时的错误的时候直接返回这个错误。
+func (s *Search) queryRows(query string, args ...interface{}) *SQLRows {
+	if s.err != nil {
+		s.table.stack(s.err, query)
+		return &SQLRows{err: s.err}
+	}
+	return s.table.Query(query, args...)
+}
+
 // Joins join语法，自动连表。
 func (s *Search) Joins(tablename string, condition ...string) *Search {
 	if len(condition) == 1 {
@@ -122,6 +307,13 @@ func (s *Search) Joins(tablename string, condition ...string) *Search {
 	return s
 }
 
+// InnerJoins INNER JOIN tablename ON condition
+// 递归CTE的递归部分只能使用INNER JOIN引用自身。
+func (s *Search) InnerJoins(tablename, condition string) *Search {
+	s.joinConditions = append(s.joinConditions, JoinCon{TableName: tablename, Condition: condition, Inner: true})
+	return s
+}
+
 // OrderBy OrderBy 默认升序
 func (s *Search) OrderBy(field string, isDESC ...bool) *Search {
 	if len(isDESC) > 0 && isDESC[0] {
@@ -158,15 +350,102 @@ func (s *Search) Group(field ...string) *Search {
 
 // Having having
 func (s *Search) Having(query string, args ...interface{}) *Search {
+	query, args, err := namedArgs(query, args)
+	if err != nil {
+		s.setErr(err)
+		return s
+	}
 	s.havingConditions = append(s.havingConditions, WhereCon{Query: query, Args: args})
 	return s
 }
 
+// With WITH name AS (sub)
+// 添加一个CTE，主查询可以通过TableName(name)或者Joins(name, condition)使用它。
+func (s *Search) With(name string, sub *Search) *Search {
+	s.with = append(s.with, WithCon{Name: name, Search: sub})
+	s.setErr(sub.err)
+	return s
+}
+
+// WithRecursive WITH RECURSIVE name AS (anchor UNION ALL recursive)
+// recursive部分一般会Joins(name, condition)来引用自身。
+func (s *Search) WithRecursive(name string, anchor, recursive *Search) *Search {
+	s.with = append(s.with, WithCon{Name: name, Search: anchor, Union: recursive, Recursive: true})
+	s.setErr(anchor.err)
+	if recursive != nil {
+		s.setErr(recursive.err)
+	}
+	return s
+}
+
+// parseWith 生成WITH语句，参数要放在主查询的参数之前。
+func (s *Search) parseWith() (string, []interface{}) {
+	if len(s.with) == 0 {
+		return "", nil
+	}
+	var (
+		recursive bool
+		ctes      []string
+		args      []interface{}
+	)
+	for _, w := range s.with {
+		query, subArgs := w.Search.Clone().Parse()
+		args = append(args, subArgs...)
+		if w.Recursive {
+			recursive = true
+			if w.Union != nil {
+				union, unionArgs := w.Union.Clone().Parse()
+				query += " UNION ALL " + union
+				args = append(args, unionArgs...)
+			}
+		}
+		ctes = append(ctes, fmt.Sprintf("`%s` AS (%s)", w.Name, query))
+	}
+	if recursive {
+		return "WITH RECURSIVE " + strings.Join(ctes, ",") + " ", args
+	}
+	return "WITH " + strings.Join(ctes, ",") + " ", args
+}
+
+// Raw 使用手写的SQL语句作为查询，可以使用Search的所有结果函数。
+// 如果之后再调用Where、OrderBy、Limit等，会把这个SQL当作子查询，别名为当前的表名。
+func (s *Search) Raw(query string, args ...interface{}) *Search {
+	query, args, err := namedArgs(query, args)
+	if err != nil {
+		s.setErr(err)
+	}
+	s.query = query
+	s.args = args
+	s.raw = true
+	return s
+}
+
 // Parse Parse
 func (s *Search) Parse() (string, []interface{}) {
 	if s.raw == true {
-		return s.query, s.args
+		if !s.haveConditions() {
+			return s.query, s.args
+		}
+		return s.build(fmt.Sprintf("(%s) AS `%s`", s.query, s.tableName), s.args)
 	}
+	if s.table.tableColumns[s.tableName].HaveColumn(IsDeleted) {
+		s.Where("is_deleted = ?", 0)
+	}
+	s.query, s.args = s.build("`"+s.tableName+"`", nil)
+	// 如果table进行搜索了(table.RowsMap())，那么table下面所有的条件都会一直使用之前的搜索语句。
+	// s.raw = true
+	return s.query, s.args
+}
+
+// haveConditions 是否有除了Raw之外的条件
+func (s *Search) haveConditions() bool {
+	return len(s.fields) > 0 || len(s.joinConditions) > 0 || len(s.whereConditions) > 0 ||
+		len(s.groupConditions) > 0 || len(s.havingConditions) > 0 || len(s.orderbyConditions) > 0 ||
+		len(s.with) > 0 || s.limit != nil || s.offset != nil
+}
+
+// build 生成SELECT语句，from为FROM后面的内容，fromArgs为from中的参数。
+func (s *Search) build(from string, fromArgs []interface{}) (string, []interface{}) {
 	var (
 		fields       string
 		joins        string
@@ -178,11 +457,8 @@ func (s *Search) Parse() (string, []interface{}) {
 		limit        string
 		offset       string
 	)
-	if s.table.tableColumns[s.tableName].HaveColumn(IsDeleted) {
-		s.Where("is_deleted = ?", 0)
-	}
-	s.query = ""
-	s.args = []interface{}{}
+	with, args := s.parseWith()
+	args = append(args, fromArgs...)
 	if len(s.fields) == 0 {
 		fields = "*"
 	} else {
@@ -198,12 +474,16 @@ func (s *Search) Parse() (string, []interface{}) {
 		fields = strings.Join(s.fields, ",")
 	}
 	for _, joincon := range s.joinConditions {
-		joins += fmt.Sprintf(" LEFT JOIN %s ON %s", joincon.TableName, joincon.Condition)
+		if joincon.Inner {
+			joins += fmt.Sprintf(" INNER JOIN %s ON %s", joincon.TableName, joincon.Condition)
+		} else {
+			joins += fmt.Sprintf(" LEFT JOIN %s ON %s", joincon.TableName, joincon.Condition)
+		}
 	}
 	for _, wherecon := range s.whereConditions {
 		paddingwhere = " WHERE "
 		wheres = append(wheres, wherecon.Query)
-		s.args = append(s.args, wherecon.Args...)
+		args = append(args, wherecon.Args...)
 	}
 	if len(s.groupConditions) > 0 {
 		groupby = " GROUP BY " + strings.Join(s.groupConditions, ",")
@@ -212,7 +492,7 @@ func (s *Search) Parse() (string, []interface{}) {
 		hcs := []string{}
 		for _, c := range s.havingConditions {
 			hcs = append(hcs, c.Query)
-			s.args = append(s.args, c.Args...)
+			args = append(args, c.Args...)
 		}
 		having = " HAVING " + strings.Join(hcs, " AND ")
 	}
@@ -221,15 +501,16 @@ func (s *Search) Parse() (string, []interface{}) {
 	}
 	if s.limit != nil {
 		limit = " LIMIT ?"
-		s.args = append(s.args, s.limit)
+		args = append(args, s.limit)
 	}
 	if s.offset != nil {
 		offset = " OFFSET ?"
-		s.args = append(s.args, s.offset)
+		args = append(args, s.offset)
 	}
-	s.query = fmt.Sprintf("SELECT %s FROM `%s`%s%s%s%s%s%s%s%s",
+	query := fmt.Sprintf("%sSELECT %s FROM %s%s%s%s%s%s%s%s%s",
+		with,
 		fields,
-		s.tableName,
+		from,
 		joins,
 		paddingwhere,
 		strings.Join(wheres, " AND "),
@@ -239,9 +520,7 @@ func (s *Search) Parse() (string, []interface{}) {
 		limit,
 		offset,
 	)
-	// 如果table进行搜索了(table.RowsMap())，那么table下面所有的条件都会一直使用之前的搜索语句。
-	// s.raw = true
-	return s.query, s.args
+	return query, args
 }
 
 // DISTINCT XX
@@ -350,13 +629,13 @@ func (s *Search) RawsMapInterface() RowsMapInterface {
 func (s *Search) RowMap() RowMap {
 	nb := (*s).Clone().Limit(1)
 	query, args := nb.Parse()
-	return s.table.Query(query, args...).RowMap()
+	return s.queryRows(query, args...).RowMap()
 }
 
 // Explain explian sql
 func (s *Search) Explain(debug bool) Explain {
 	query, args := s.Parse()
-	r := s.table.Query("EXPLAIN "+query, args...).RowMap()
+	r := s.queryRows("EXPLAIN "+query, args...).RowMap()
 	if debug {
 		fmt.Println(query)
 		fmt.Println(args)
@@ -386,31 +665,43 @@ func (s *Search) Explain(debug bool) Explain {
 // SQLRows SQLRows
 func (s *Search) SQLRows() *SQLRows {
 	query, args := s.Parse()
-	return s.table.Query(query, args...)
+	return s.queryRows(query, args...)
+}
+
+// Each 逐行遍历查询结果，详见SQLRows.Each
+func (s *Search) Each(f func(RowMap) error) error {
+	query, args := s.Parse()
+	return s.queryRows(query, args...).Each(f)
 }
 
 // RowsMap RowsMap
 func (s *Search) RowsMap() RowsMap {
 	query, args := s.Parse()
-	return s.table.Query(query, args...).RowsMap()
+	return s.queryRows(query, args...).RowsMap()
+}
+
+// Rows 返回保持列顺序和NULL的结果，详见SQLRows.Rows
+func (s *Search) Rows() (Rows, error) {
+	query, args := s.Parse()
+	return s.queryRows(query, args...).Rows()
 }
 
 // RowMapInterface RowMapInterface
 func (s *Search) RowMapInterface() RowMapInterface {
 	query, args := s.Parse()
-	return s.table.Query(query, args...).RowMapInterface()
+	return s.queryRows(query, args...).RowMapInterface()
 }
 
 // RowsMapInterface RowsMapInterface
 func (s *Search) RowsMapInterface() RowsMapInterface {
 	query, args := s.Parse()
-	return s.table.Query(query, args...).RowsMapInterface()
+	return s.queryRows(query, args...).RowsMapInterface()
 }
 
 // DoubleSlice DoubleSlice
 func (s *Search) DoubleSlice() (map[string]int, [][]string) {
 	query, args := s.Parse()
-	return s.table.Query(query, args...).DoubleSlice()
+	return s.queryRows(query, args...).DoubleSlice()
 }
 
 // Int 如果指定字段，则返回指定字段的int值，否则返回第一个字段作为int值返回。
@@ -449,15 +740,29 @@ func (s *Search) Bool(args ...string) bool {
 
 // Finds 将查询的结构放入到结构体当中
 func (s *Search) Finds(v interface{}) error {
+	if s.err != nil {
+		return s.err
+	}
 	query, args := s.Parse()
 	return s.table.FindAll(v, append([]interface{}{query}, args...)...)
 }
 
-// //Count 计算这次查询结果的个数
-// func (s *Search) Count() int {
-// 	var count int
-// 	s.fields = []string{"COUNT(*)"}
-// 	query, args := s.Parse()
-// 	s.table.Query(query, args...).Find(&count)
-// 	return count
-// }
+// Count 计算这次查询结果的行数
+// 查询会被当作子查询，所以对Raw和GROUP BY也是准确的，ORDER BY、LIMIT、OFFSET会被忽略。
+func (s *Search) Count() int {
+	ns := s.Clone()
+	ns.orderbyConditions = nil
+	ns.limit = nil
+	ns.offset = nil
+	query, args := ns.Parse()
+	return s.queryRows("SELECT COUNT(1) FROM ("+query+") AS count_table", args...).Int()
+}
+
+// Paginate 分页查询，page从1开始，返回当页的数据和总行数。
+func (s *Search) Paginate(page, size int) (RowsMap, int) {
+	if page < 1 {
+		page = 1
+	}
+	rows := s.Clone().Limit(size).Offset((page - 1) * size).RowsMap()
+	return rows, s.Count()
+}
@@ -0,0 +1,176 @@
+package crud
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func newTestDataBase(tables map[string][]string) *DataBase {
+	db := &DataBase{
+		tableColumns: make(map[string]Columns),
+		mm:           new(sync.Mutex),
+	}
+	for tableName, cols := range tables {
+		cm := make(Columns)
+		for _, col := range cols {
+			cm[col] = Column{Table: tableName, Name: col}
+		}
+		db.tableColumns[tableName] = cm
+	}
+	return db
+}
+
+func TestSearch_With(t *testing.T) {
+	db := newTestDataBase(map[string][]string{"dept": {"id", "parent_id", "name"}})
+	anchor := db.Table("dept").Where("parent_id = ?", 0).Search
+	recursive := db.Table("dept").InnerJoins("tree", "dept.parent_id = tree.id").Search
+	query, args := db.Table("tree").WithRecursive("tree", anchor, recursive).Where("name LIKE ?", "a%").Limit(10).Parse()
+	want := "WITH RECURSIVE `tree` AS (SELECT * FROM `dept` WHERE parent_id = ? UNION ALL SELECT * FROM `dept` INNER JOIN tree ON dept.parent_id = tree.id) SELECT * FROM `tree` WHERE name LIKE ? LIMIT ?"
+	if query != want {
+		t.Fatalf("Parse() query = %s, want %s", query, want)
+	}
+	if !reflect.DeepEqual(args, []interface{}{0, "a%", 10}) {
+		t.Fatalf("Parse() args = %v", args)
+	}
+}
+
+func TestSearch_Raw(t *testing.T) {
+	db := newTestDataBase(map[string][]string{"user": {"id", "name", "age"}})
+	raw := "SELECT user_id, SUM(amount) AS total FROM `order` WHERE created_at >= :since GROUP BY user_id"
+
+	query, args := db.Table("user").Raw(raw, map[string]interface{}{"since": "2021-01-01"}).Parse()
+	want := "SELECT user_id, SUM(amount) AS total FROM `order` WHERE created_at >= ? GROUP BY user_id"
+	if query != want || !reflect.DeepEqual(args, []interface{}{"2021-01-01"}) {
+		t.Fatalf("Parse() = %s %v, want %s", query, args, want)
+	}
+
+	query, args = db.Table("user").Raw(raw, map[string]interface{}{"since": "2021-01-01"}).Where("total > ?", 100).OrderBy("total", true).Limit(10).Parse()
+	want = "SELECT * FROM (SELECT user_id, SUM(amount) AS total FROM `order` WHERE created_at >= ? GROUP BY user_id) AS `user` WHERE total > ? ORDER BY total DESC LIMIT ?"
+	if query != want || !reflect.DeepEqual(args, []interface{}{"2021-01-01", 100, 10}) {
+		t.Fatalf("Parse() = %s %v, want %s", query, args, want)
+	}
+}
+
+func TestSearch_WhereStructMap(t *testing.T) {
+	type order struct {
+		ID     int
+		UserID int
+		Status int `dbname:"state"`
+		Remark string
+		Price  namedMoney
+	}
+	db := newTestDataBase(map[string][]string{"order": {"id", "user_id", "state", "remark", "price", "age", "deleted_at"}})
+
+	query, args := db.Table("order").WhereStruct(&order{UserID: 3, Status: 1}).Parse()
+	want := "SELECT * FROM `order` WHERE `order`.`user_id` = ? AND `order`.`state` = ?"
+	if query != want || !reflect.DeepEqual(args, []interface{}{3, 1}) {
+		t.Fatalf("WhereStruct Parse() = %s %v, want %s", query, args, want)
+	}
+	query, args = db.Table("order").WhereStruct(&order{ID: 1, Remark: "a:b", Price: namedMoney{5}}).Parse()
+	want = "SELECT * FROM `order` WHERE `order`.`id` = ? AND `order`.`remark` = ? AND `order`.`price` = ?"
+	if query != want || !reflect.DeepEqual(args, []interface{}{1, "a:b", namedMoney{5}}) {
+		t.Fatalf("WhereStruct Parse() = %s %v, want %s", query, args, want)
+	}
+
+	query, args = db.Table("order").WhereMap(map[string]interface{}{
+		"age >":        18,
+		"state IN":     []int{1, 2},
+		"deleted_at":   nil,
+		"remark !=":    []string{},
+		"user_id like": "3%",
+	}).Parse()
+	want = "SELECT * FROM `order` WHERE `order`.`age` > ? AND `order`.`deleted_at` IS NULL AND `order`.`state` IN (?,?) AND `order`.`user_id` LIKE ?"
+	if query != want || !reflect.DeepEqual(args, []interface{}{18, 1, 2, "3%"}) {
+		t.Fatalf("WhereMap Parse() = %s %v, want %s", query, args, want)
+	}
+
+	s := db.Table("order").WhereMap(map[string]interface{}{
+		"user.age not between": []int{1, 9},
+		"deleted_at is not":    nil,
+		"`remark` NOT IN":      []string{"a"},
+	}).Search
+	query, args = s.Parse()
+	want = "SELECT * FROM `order` WHERE `order`.`remark` NOT IN (?) AND `order`.`deleted_at` IS NOT NULL AND `user`.`age` NOT BETWEEN ? AND ?"
+	if s.Err() != nil || query != want || !reflect.DeepEqual(args, []interface{}{"a", 1, 9}) {
+		t.Fatalf("WhereMap Parse() = %s %v %v, want %s", query, args, s.Err(), want)
+	}
+
+	for _, m := range []map[string]interface{}{
+		{"age = 1 OR 1 = 1 --": 1},
+		{"age ; DROP TABLE order": 1},
+		{"age REGEXP": "a"},
+		{"age) OR (1": 1},
+		{"a.b.c": 1},
+		{"age BETWEEN": []int{1}},
+		{"age BETWEEN": 1},
+		{"age IS": 1},
+		{"age >": nil},
+		{"age >": []int{1, 2}},
+	} {
+		if err := db.Table("order").WhereMap(m).Search.Err(); !errors.Is(err, ErrArgs) {
+			t.Errorf("WhereMap(%v) Err() = %v, want %v", m, err, ErrArgs)
+		}
+	}
+}
+
+func TestSearch_NamedArgsErr(t *testing.T) {
+	db := newTestDataBase(map[string][]string{"user": {"id", "name", "age"}})
+
+	s := db.Table("user").Where("name = :name AND age > :age", map[string]interface{}{"name": "a"}).Where("id > ?", 0).Search
+	if !errors.Is(s.Err(), ErrArgs) {
+		t.Fatalf("Where() Err() = %v, want %v", s.Err(), ErrArgs)
+	}
+	var users []struct{ ID int }
+	if err := s.Finds(&users); err != s.Err() {
+		t.Fatalf("Finds() = %v, want %v", err, s.Err())
+	}
+	if err := s.Each(func(RowMap) error { return nil }); err != s.Err() {
+		t.Fatalf("Each() = %v, want %v", err, s.Err())
+	}
+	if rows := s.RowsMap(); len(rows) != 0 {
+		t.Fatalf("RowsMap() = %v, want empty", rows)
+	}
+	if n := s.Count(); n != 0 {
+		t.Fatalf("Count() = %d, want 0", n)
+	}
+	if n := s.Int(); n != 0 {
+		t.Fatalf("Int() = %d, want 0", n)
+	}
+	if err := s.SQLRows().Err(); err != s.Err() {
+		t.Fatalf("SQLRows().Err() = %v, want %v", err, s.Err())
+	}
+
+	s = db.Table("user").Group("name").Having("COUNT(*) > :n", map[string]interface{}{"m": 1}).Search
+	if !errors.Is(s.Err(), ErrArgs) {
+		t.Fatalf("Having() Err() = %v, want %v", s.Err(), ErrArgs)
+	}
+	if _, err := s.AggregateGroup(AggSum, "age"); err != s.Err() {
+		t.Fatalf("AggregateGroup() = %v, want %v", err, s.Err())
+	}
+	if v := s.Sum("age"); v.Err() != s.Err() || !v.IsNull() {
+		t.Fatalf("Sum() = %v %v, want NULL and %v", v.String(), v.Err(), s.Err())
+	}
+	if _, err := Pluck[int](s, "age"); err != s.Err() {
+		t.Fatalf("Pluck() = %v, want %v", err, s.Err())
+	}
+}
+
+func TestSearch_RawNamedArgsErr(t *testing.T) {
+	db := newTestDataBase(map[string][]string{"user": {"id", "name", "age"}})
+	s := db.Table("user").Raw("SELECT * FROM `user` WHERE age > :age", map[string]interface{}{"name": "a"})
+	if !errors.Is(s.Err(), ErrArgs) {
+		t.Fatalf("Raw() Err() = %v, want %v", s.Err(), ErrArgs)
+	}
+	if rows := s.Where("name = ?", "a").RowsMap(); len(rows) != 0 {
+		t.Fatalf("RowsMap() = %v, want empty", rows)
+	}
+	var users []struct{ ID int }
+	if err := s.Finds(&users); err != s.Err() {
+		t.Fatalf("Finds() = %v, want %v", err, s.Err())
+	}
+	if _, err := First[struct{ ID int }](s); err != s.Err() {
+		t.Fatalf("First() = %v, want %v", err, s.Err())
+	}
+}
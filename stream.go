@@ -0,0 +1,120 @@
+package crud
+
+import (
+	"database/sql"
+	"reflect"
+)
+
+// Each 逐行遍历结果，不会把所有数据加载到内存中。
+// 回调是同步执行的，回调没有返回之前不会读取下一行，所以处理慢的时候也不会堆积数据。
+// 回调返回ErrBreak时提前结束遍历并返回nil，返回其他错误时结束遍历并返回这个错误，
+// 无论如何结束都会关闭*sql.Rows。
+func (r *SQLRows) Each(f func(RowMap) error) error {
+	return r.eachRaw(func(cols []string, raws []sql.RawBytes) error {
+		row := make(RowMap, len(cols))
+		for i, col := range cols {
+			row[col] = string(raws[i])
+		}
+		return f(row)
+	})
+}
+
+// eachRaw 逐行遍历原始数据，raws在下一次回调的时候会被覆盖，需要保存的话要复制一份。
+func (r *SQLRows) eachRaw(f func(cols []string, raws []sql.RawBytes) error) error {
+	if r.err != nil {
+		return r.err
+	}
+	if r.rows == nil {
+		return nil
+	}
+	defer r.rows.Close()
+	cols, err := r.columns()
+	if err != nil {
+		return err
+	}
+	raws := make([]sql.RawBytes, len(cols))
+	dest := make([]interface{}, len(cols))
+	for i := range raws {
+		dest[i] = &raws[i]
+	}
+	for r.rows.Next() {
+		if err := r.rows.Scan(dest...); err != nil {
+			return err
+		}
+		if err := f(cols, raws); err != nil {
+			if err == ErrBreak {
+				return nil
+			}
+			return err
+		}
+	}
+	return r.rows.Err()
+}
+
+// Next 游标，将下一行数据放到v中(规则和Find一样)，没有数据或者出错的时候返回false并关闭*sql.Rows。
+//
+//	rows := db.Query("SELECT * FROM user")
+//	defer rows.Close()
+//	for rows.Next(&u) {
+//	}
+//	if err := rows.Err(); err != nil {
+//	}
+func (r *SQLRows) Next(v interface{}) bool {
+	if r.err != nil || r.rows == nil {
+		return false
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		r.fail(ErrMustBeAddr)
+		return false
+	}
+	if _, err := r.columns(); err != nil {
+		r.fail(err)
+		return false
+	}
+	if !r.rows.Next() {
+		r.fail(r.rows.Err())
+		return false
+	}
+	vals, err := scanValues(r.rows, len(r.cols))
+	if err != nil {
+		r.fail(err)
+		return false
+	}
+	if err := setRow(rv.Elem(), r.cols, vals); err != nil {
+		r.fail(err)
+		return false
+	}
+	return true
+}
+
+// columns 查询结果的列名，按照SELECT的顺序
+func (r *SQLRows) columns() ([]string, error) {
+	if r.cols != nil {
+		return r.cols, nil
+	}
+	cols, err := r.rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	r.cols = cols
+	return cols, nil
+}
+
+// Err 返回查询或者遍历过程中的错误
+func (r *SQLRows) Err() error {
+	return r.err
+}
+
+// Close 关闭*sql.Rows，游标没有遍历完就退出的时候需要调用。
+func (r *SQLRows) Close() error {
+	if r.rows == nil {
+		return nil
+	}
+	return r.rows.Close()
+}
+
+func (r *SQLRows) fail(err error) {
+	r.err = err
+	r.rows.Close()
+}
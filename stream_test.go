@@ -0,0 +1,96 @@
+package crud
+
+import (
+	"database/sql/driver"
+	"errors"
+	"testing"
+)
+
+func newStreamDataBase(t *testing.T, rowsErr error) (*DataBase, *fakeDB) {
+	db, fdb := newFakeDataBase(t, map[string][]string{"user": {"id", "name"}})
+	fdb.query = func(query string, args []driver.Value) (*fakeRows, error) {
+		rows := newFakeRows([]string{"id", "name"},
+			[]driver.Value{int64(1), []byte("a")},
+			[]driver.Value{int64(2), []byte("b")},
+			[]driver.Value{int64(3), []byte("c")},
+		)
+		rows.err = rowsErr
+		return rows, nil
+	}
+	return db, fdb
+}
+
+func TestSearch_Each(t *testing.T) {
+	db, fdb := newStreamDataBase(t, nil)
+	var ids []string
+	err := db.Table("user").Each(func(r RowMap) error {
+		ids = append(ids, r["id"])
+		if len(ids) == 2 {
+			return ErrBreak
+		}
+		return nil
+	})
+	if err != nil || len(ids) != 2 || fdb.openRows() != 0 {
+		t.Fatalf("Each() with ErrBreak = %v %v, %d rows open", ids, err, fdb.openRows())
+	}
+
+	errStop := errors.New("stop")
+	err = db.Table("user").Each(func(r RowMap) error { return errStop })
+	if err != errStop || fdb.openRows() != 0 {
+		t.Fatalf("Each() with error = %v, %d rows open", err, fdb.openRows())
+	}
+
+	errConn := errors.New("connection reset")
+	db, fdb = newStreamDataBase(t, errConn)
+	n := 0
+	err = db.Table("user").Each(func(r RowMap) error {
+		n++
+		return nil
+	})
+	if err != errConn || n != 3 || fdb.openRows() != 0 {
+		t.Fatalf("Each() with rows error = %v after %d rows, %d rows open", err, n, fdb.openRows())
+	}
+}
+
+func TestSQLRows_Next(t *testing.T) {
+	type user struct {
+		ID   int
+		Name string
+	}
+	db, fdb := newStreamDataBase(t, nil)
+
+	rows := db.Query("SELECT * FROM user")
+	var u user
+	var names []string
+	for rows.Next(&u) {
+		names = append(names, u.Name)
+	}
+	if rows.Err() != nil || len(names) != 3 || fdb.openRows() != 0 {
+		t.Fatalf("Next() = %v %v, %d rows open", names, rows.Err(), fdb.openRows())
+	}
+
+	rows = db.Query("SELECT * FROM user")
+	if !rows.Next(&u) || u.ID != 1 {
+		t.Fatalf("Next() = %v %v", u, rows.Err())
+	}
+	rows.Close()
+	if fdb.openRows() != 0 {
+		t.Fatalf("Close() after an early return left %d rows open", fdb.openRows())
+	}
+
+	rows = db.Query("SELECT * FROM user")
+	if rows.Next(u) || !errors.Is(rows.Err(), ErrMustBeAddr) || fdb.openRows() != 0 {
+		t.Fatalf("Next(non-pointer) = %v, %d rows open", rows.Err(), fdb.openRows())
+	}
+
+	errConn := errors.New("connection reset")
+	db, fdb = newStreamDataBase(t, errConn)
+	rows = db.Query("SELECT * FROM user")
+	n := 0
+	for rows.Next(&u) {
+		n++
+	}
+	if rows.Err() != errConn || n != 3 || fdb.openRows() != 0 {
+		t.Fatalf("Next() with rows error = %v after %d rows, %d rows open", rows.Err(), n, fdb.openRows())
+	}
+}
@@ -3,6 +3,7 @@ package crud
 import (
 	"errors"
 	"fmt"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -83,39 +84,114 @@ func (t *Table) Create(m map[string]interface{}, checks ...string) (int64, error
 	if err != nil {
 		return 0, errors.New("SQL语句异常")
 	}
-	if id <= 0 {
+	// 主键不是自增的表LastInsertId为0
+	if id <= 0 && (len(t.Columns) == 0 || t.Columns.AutoIncrement() != "") {
 		return 0, errors.New("插入数据库异常")
 	}
 	return id, nil
 }
 
 // Creates 创建多列
+// 每个map的key可以不一样，map中没有的列使用DEFAULT。
+// 占位符超过65535个或者行数超过BatchSize的时候会分成多条INSERT语句执行，返回影响的行数。
 func (t *Table) Creates(ms []map[string]interface{}) (int, error) {
+	affected, err := t.creates(ms, nil)
+	return int(affected), err
+}
+
+// creates 分批执行INSERT，每一批执行成功后调用f，start、end为这一批在ms中的范围，firstID为LastInsertId。
+func (t *Table) creates(ms []map[string]interface{}, f func(start, end int, firstID int64) error) (int64, error) {
 	if len(ms) == 0 {
 		return 0, nil
 	}
-	// INSERT INTO `feedback` (`task_id`, `template_question_id`, `question_options_id`, `suggestion`, `member_id`) VALUES ('1', '1', '1', '1', '1'),('1', '1', '1', '1', '1')
-	fields := []string{}
-	args := []interface{}{}
-	sqlFields := []string{}
-	sqlArgs := []string{}
-	sqlArg := "(" + argslice(len(ms[0])) + ")"
-	for i := 0; i < len(ms); i++ {
-		sqlArgs = append(sqlArgs, sqlArg)
+	if t.Columns.HaveColumn(CreatedAt) {
+		now := time.Now().Format(TimeFormat)
+		for _, m := range ms {
+			m[CreatedAt] = now
+		}
 	}
-
-	for k := range ms[0] {
-		fields = append(fields, k)
-		sqlFields = append(sqlFields, "`"+k+"`")
+	var affected int64
+	for _, b := range buildInserts(t.tableName, ms, t.getBatchSize()) {
+		ret := t.Exec(b.query, b.args...)
+		rows, err := ret.RowsAffected()
+		if err != nil {
+			return affected, err
+		}
+		affected += rows
+		if f != nil {
+			id, _ := ret.LastInsertId()
+			if err := f(b.start, b.end, id); err != nil {
+				return affected, err
+			}
+		}
 	}
+	return affected, nil
+}
 
-	for _, v := range ms {
-		for _, field := range fields {
-			args = append(args, v[field])
+// maxPlaceholders MySQL一条语句最多的占位符个数
+const maxPlaceholders = 65535
+
+// insertBatch 一条多行的INSERT语句，对应ms[start:end]
+type insertBatch struct {
+	start, end int
+	query      string
+	args       []interface{}
+}
+
+// buildInserts 生成多行的INSERT语句，列为所有map中key的并集。
+// INSERT INTO `feedback` (`member_id`,`task_id`) VALUES (?,?),(?,DEFAULT)
+func buildInserts(tableName string, ms []map[string]interface{}, batchSize int) []insertBatch {
+	fieldSet := map[string]bool{}
+	fields := []string{}
+	for _, m := range ms {
+		for k := range m {
+			if !fieldSet[k] {
+				fieldSet[k] = true
+				fields = append(fields, k)
+			}
+		}
+	}
+	sort.Strings(fields)
+	sqlFields := make([]string, len(fields))
+	for i, field := range fields {
+		sqlFields[i] = "`" + field + "`"
+	}
+	size := len(ms)
+	if len(fields) > 0 {
+		size = maxPlaceholders / len(fields)
+	}
+	if batchSize > 0 && batchSize < size {
+		size = batchSize
+	}
+	batches := []insertBatch{}
+	for start := 0; start < len(ms); start += size {
+		end := start + size
+		if end > len(ms) {
+			end = len(ms)
 		}
+		b := insertBatch{start: start, end: end}
+		values := make([]string, 0, end-start)
+		for _, m := range ms[start:end] {
+			if len(fields) == 0 {
+				values = append(values, "()")
+				continue
+			}
+			row := make([]string, len(fields))
+			for i, field := range fields {
+				v, ok := m[field]
+				if !ok {
+					row[i] = "DEFAULT"
+					continue
+				}
+				row[i] = "?"
+				b.args = append(b.args, v)
+			}
+			values = append(values, "("+strings.Join(row, ",")+")")
+		}
+		b.query = fmt.Sprintf("INSERT INTO `%s` (%s) VALUES %s", tableName, strings.Join(sqlFields, ","), strings.Join(values, ","))
+		batches = append(batches, b)
 	}
-	rows, err := t.Exec(fmt.Sprintf("INSERT INTO `%s` (%s) VALUES %s ", t.tableName, strings.Join(sqlFields, ","), strings.Join(sqlArgs, ",")), args...).RowsAffected()
-	return int(rows), err
+	return batches
 }
 
 // Read 查找单条数据
@@ -138,22 +214,51 @@ func (t *Table) Reads(m map[string]interface{}) RowsMap {
 }
 
 // Update 更新
-// 如果map里面有id的话会自动删除id，然后使用id来作为更新的条件。
-func (t *Table) Update(mo map[string]interface{}, keys ...string) error {
+// keys为更新的条件，默认为表的主键(联合主键为多个)，表结构中没有主键的时候为id。
+// 如果map里面有id的话会自动删除id。
+// 开启了乐观锁(OptimisticLock)的时候map中的版本号会作为条件，版本号不匹配时返回ErrStaleObject。
+func (t *Table) Update(m map[string]interface{}, keys ...string) error {
+	_, err := t.update(m, keys...)
+	return err
+}
+
+// update 更新并返回影响的行数
+func (t *Table) update(mo map[string]interface{}, keys ...string) (int64, error) {
 	// 因为会删除id，所以使用的时候要copy一个map
 	m := copyMap(mo)
 	if len(keys) == 0 {
-		keys = append(keys, "id")
+		keys = t.primaryKeys()
 	}
 	if t.tableColumns[t.tableName].HaveColumn(UpdatedAt) {
 		m[UpdatedAt] = time.Now().Format(TimeFormat)
 	}
+	version := t.versionColumn
+	if !t.Columns.HaveColumn(version) {
+		version = ""
+	}
+	query, args, locked, err := buildUpdate(t.tableName, m, keys, version)
+	if err != nil {
+		return 0, err
+	}
+	n, err := t.Exec(query, args...).RowsAffected()
+	if err != nil {
+		return 0, errors.New("SQL语句异常")
+	}
+	if locked && n == 0 {
+		return 0, ErrStaleObject
+	}
+	return n, nil
+}
+
+// buildUpdate 生成UPDATE语句，m会被修改。
+// version不为空的时候会将版本号加1，m中有版本号的时候作为条件，locked为true。
+func buildUpdate(tableName string, m map[string]interface{}, keys []string, version string) (query string, args []interface{}, locked bool, err error) {
 	keysValue := []interface{}{}
 	whereks := []string{}
 	for _, key := range keys {
 		val, ok := m[key]
 		if !ok {
-			return errors.New("没有更新主键")
+			return "", nil, false, ErrNoUpdateKey
 		}
 		keysValue = append(keysValue, val)
 		delete(m, key)
@@ -161,18 +266,35 @@ func (t *Table) Update(mo map[string]interface{}, keys ...string) error {
 	}
 	//因为在更新的时候最好不要更新ID，而有时候又会将ID传入进来，所以id每次都会被删除，如果要更新id的话使用Exec()
 	delete(m, "id")
-	ks, vs := ksvs(m, " = ? ")
-	for _, val := range keysValue {
-		vs = append(vs, val)
+	// 乐观锁，map中有版本号的时候作为条件，没有的时候只将版本号加1
+	if version != "" {
+		if val, ok := m[version]; ok {
+			keysValue = append(keysValue, val)
+			whereks = append(whereks, "`"+version+"` = ? ")
+			locked = true
+		}
+		delete(m, version)
 	}
-	_, err := t.Exec(fmt.Sprintf("UPDATE `%s` SET %s WHERE %s LIMIT 1", t.tableName, strings.Join(ks, ","), strings.Join(whereks, "AND")), vs...).RowsAffected()
-	if err != nil {
-		return errors.New("SQL语句异常")
+	// map是无序的，排序后生成的SQL语句才是固定的。
+	cols := make([]string, 0, len(m))
+	for k := range m {
+		cols = append(cols, k)
 	}
-	return nil
+	sort.Strings(cols)
+	ks := make([]string, 0, len(cols)+1)
+	for _, k := range cols {
+		ks = append(ks, " `"+k+"` = ? ")
+		args = append(args, m[k])
+	}
+	if version != "" {
+		ks = append(ks, fmt.Sprintf("`%s` = `%s` + 1 ", version, version))
+	}
+	args = append(args, keysValue...)
+	return fmt.Sprintf("UPDATE `%s` SET %s WHERE %s LIMIT 1", tableName, strings.Join(ks, ","), strings.Join(whereks, "AND")), args, locked, nil
 }
 
 // CreateOrUpdate 创建或者更新
+// 先查询再插入或者更新，并发的时候可能会重复插入，这种情况请使用Upsert。
 func (t *Table) CreateOrUpdate(m map[string]interface{}, keys ...string) error {
 	_, err := t.Create(m, keys...)
 	if err != nil {
@@ -188,6 +310,83 @@ func (t *Table) CreateOrUpdate(m map[string]interface{}, keys ...string) error {
 	return nil
 }
 
+// UpsertResult Upsert的结果
+type UpsertResult struct {
+	ID       int64 // 自增主键，插入时为新的ID，更新时为已有行的ID(表需要有自增列)
+	Inserted bool  // 插入了新的行
+	Updated  bool  // 更新了已有的行，已有的行没有任何变化的时候Inserted和Updated都为false
+}
+
+// Upsert 使用一条INSERT ... ON DUPLICATE KEY UPDATE插入或者更新，主键或者唯一索引冲突的时候更新。
+// updateColumns为冲突时更新的列，默认为m中除了主键和created_at以外的所有列。
+// 列名会更新为这次插入的值：`count` = VALUES(`count`)，
+// 含有=的会当作表达式直接使用：count = count + VALUES(count)。
+func (t *Table) Upsert(m map[string]interface{}, updateColumns ...string) (UpsertResult, error) {
+	if len(m) == 0 {
+		return UpsertResult{}, ErrArgs
+	}
+	if t.Columns.HaveColumn(CreatedAt) {
+		m[CreatedAt] = time.Now().Format(TimeFormat)
+	}
+	if t.Columns.HaveColumn(UpdatedAt) {
+		m[UpdatedAt] = time.Now().Format(TimeFormat)
+	}
+	if len(updateColumns) == 0 {
+		pks := map[string]bool{CreatedAt: true}
+		for _, pk := range t.primaryKeys() {
+			pks[pk] = true
+		}
+		for k := range m {
+			if !pks[k] {
+				updateColumns = append(updateColumns, k)
+			}
+		}
+		sort.Strings(updateColumns)
+	}
+	query, args := buildUpsert(t.tableName, m, updateColumns, t.Columns.AutoIncrement())
+	ret := t.Exec(query, args...)
+	affected, err := ret.RowsAffected()
+	if err != nil {
+		return UpsertResult{}, err
+	}
+	id, _ := ret.LastInsertId()
+	// MySQL插入的时候影响行数为1，更新的时候为2，没有变化的时候为0
+	return UpsertResult{ID: id, Inserted: affected == 1, Updated: affected == 2}, nil
+}
+
+// buildUpsert 生成INSERT ... ON DUPLICATE KEY UPDATE语句
+// autoIncr为自增列，会加上`id` = LAST_INSERT_ID(`id`)，这样更新的时候LastInsertId也能返回已有行的ID。
+func buildUpsert(tableName string, m map[string]interface{}, updateColumns []string, autoIncr string) (string, []interface{}) {
+	fields := make([]string, 0, len(m))
+	for k := range m {
+		fields = append(fields, k)
+	}
+	sort.Strings(fields)
+	sqlFields := make([]string, len(fields))
+	args := make([]interface{}, len(fields))
+	for i, field := range fields {
+		sqlFields[i] = "`" + field + "`"
+		args[i] = m[field]
+	}
+	updates := []string{}
+	for _, col := range updateColumns {
+		if strings.Contains(col, "=") {
+			updates = append(updates, col)
+		} else {
+			updates = append(updates, fmt.Sprintf("`%s` = VALUES(`%s`)", col, col))
+		}
+	}
+	if autoIncr != "" {
+		updates = append(updates, fmt.Sprintf("`%s` = LAST_INSERT_ID(`%s`)", autoIncr, autoIncr))
+	}
+	if len(updates) == 0 {
+		// 没有需要更新的列，冲突的时候什么都不做
+		updates = append(updates, fmt.Sprintf("`%s` = `%s`", fields[0], fields[0]))
+	}
+	query := fmt.Sprintf("INSERT INTO `%s` (%s) VALUES (%s) ON DUPLICATE KEY UPDATE %s", tableName, strings.Join(sqlFields, ","), argslice(len(fields)), strings.Join(updates, ","))
+	return query, args
+}
+
 // Delete 删除
 func (t *Table) Delete(m map[string]interface{}) (int64, error) {
 	if len(m) == 0 {
@@ -200,12 +399,21 @@ func (t *Table) Delete(m map[string]interface{}) (int64, error) {
 	return t.Exec(fmt.Sprintf("DELETE FROM `%s` WHERE %s", t.tableName, strings.Join(ks, "AND")), vs...).RowsAffected()
 }
 
+// primaryKeys 表的主键，表结构中没有主键的时候为id
+func (t *Table) primaryKeys() []string {
+	if pks := t.Columns.PrimaryKeys(); len(pks) > 0 {
+		return pks
+	}
+	return []string{defaultPKDB}
+}
+
 // Clone 克隆
 // 克隆要保证状态在每个链式操作后都是独立的。
 func (t *Table) Clone() *Table {
 	newTable := &Table{
 		DataBase:  t.DataBase,
 		tableName: t.tableName,
+		Columns:   t.Columns,
 	}
 	if t.Search == nil {
 		newTable.Search = &Search{table: newTable, tableName: t.tableName}
@@ -216,11 +424,28 @@ func (t *Table) Clone() *Table {
 	return newTable
 }
 
+// Raw 使用手写的SQL语句查询，之前Table上的条件不会被使用。
+func (t *Table) Raw(query string, args ...interface{}) *Search {
+	nt := t.Clone()
+	nt.Search = &Search{table: nt, tableName: t.tableName}
+	return nt.Search.Raw(query, args...)
+}
+
 // Where field = arg
 func (t *Table) Where(query string, args ...interface{}) *Table {
 	return t.Clone().Search.Where(query, args...).table
 }
 
+// WhereStruct 使用结构体中非零值的字段作为条件
+func (t *Table) WhereStruct(obj interface{}) *Table {
+	return t.Clone().Search.WhereStruct(obj).table
+}
+
+// WhereMap 使用map作为条件，key中可以带操作符，如"age >"、"status IN"
+func (t *Table) WhereMap(m map[string]interface{}) *Table {
+	return t.Clone().Search.WhereMap(m).table
+}
+
 // WhereNotEmpty if arg empty,will do nothing
 func (t *Table) WhereNotEmpty(query, arg string) *Table {
 	if arg == "" {
@@ -339,12 +564,27 @@ func (t *Table) NotIn(field string, args ...interface{}) *Table {
 	return t.Clone().Search.NotIn(field, args...).table
 }
 
+// With WITH name AS (sub)
+func (t *Table) With(name string, sub *Search) *Table {
+	return t.Clone().Search.With(name, sub).table
+}
+
+// WithRecursive WITH RECURSIVE name AS (anchor UNION ALL recursive)
+func (t *Table) WithRecursive(name string, anchor, recursive *Search) *Table {
+	return t.Clone().Search.WithRecursive(name, anchor, recursive).table
+}
+
 // Joins LEFT JOIN
 // with auto join map
 func (t *Table) Joins(query string, args ...string) *Table {
 	return t.Clone().Search.Joins(query, args...).table
 }
 
+// InnerJoins INNER JOIN
+func (t *Table) InnerJoins(tablename, condition string) *Table {
+	return t.Clone().Search.InnerJoins(tablename, condition).table
+}
+
 // OrderBy ORDER BY
 func (t *Table) OrderBy(field string, isDESC ...bool) *Table {
 	return t.Clone().Search.OrderBy(field, isDESC...).table
@@ -389,6 +629,6 @@ func (t *Table) Count() int {
 	var count int
 	s.fields = []string{"COUNT(1)"}
 	query, args := s.Parse()
-	s.table.Query(query, args...).Find(&count)
+	s.queryRows(query, args...).Find(&count)
 	return count
 }
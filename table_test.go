@@ -0,0 +1,130 @@
+package crud
+
+import (
+	"database/sql/driver"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBuildInserts(t *testing.T) {
+	ms := []map[string]interface{}{
+		{"name": "a", "age": 1},
+		{"name": "b"},
+		{"age": 3, "email": "c@x"},
+	}
+	batches := buildInserts("user", ms, 2)
+	if len(batches) != 2 {
+		t.Fatalf("buildInserts() len = %d, want 2", len(batches))
+	}
+	want := "INSERT INTO `user` (`age`,`email`,`name`) VALUES (?,DEFAULT,?),(DEFAULT,DEFAULT,?)"
+	if batches[0].query != want || batches[0].start != 0 || batches[0].end != 2 {
+		t.Fatalf("buildInserts() batch 0 = %+v", batches[0])
+	}
+	if !reflect.DeepEqual(batches[0].args, []interface{}{1, "a", "b"}) {
+		t.Fatalf("buildInserts() batch 0 args = %v", batches[0].args)
+	}
+	want = "INSERT INTO `user` (`age`,`email`,`name`) VALUES (?,?,DEFAULT)"
+	if batches[1].query != want || batches[1].start != 2 || batches[1].end != 3 {
+		t.Fatalf("buildInserts() batch 1 = %+v", batches[1])
+	}
+
+	// 占位符不能超过65535个
+	ms = make([]map[string]interface{}, 70000)
+	for i := range ms {
+		ms[i] = map[string]interface{}{"id": i}
+	}
+	batches = buildInserts("user", ms, 0)
+	if len(batches) != 2 || batches[0].end != maxPlaceholders || len(batches[0].args) != maxPlaceholders {
+		t.Fatalf("buildInserts() placeholder limit, got %d batches", len(batches))
+	}
+}
+
+func TestBuildUpsert(t *testing.T) {
+	m := map[string]interface{}{"user_id": 1, "day": "2020-01-01", "count": 2}
+	query, args := buildUpsert("stat", m, []string{"count = count + VALUES(count)", "day"}, "id")
+	want := "INSERT INTO `stat` (`count`,`day`,`user_id`) VALUES (?,?,?) ON DUPLICATE KEY UPDATE count = count + VALUES(count),`day` = VALUES(`day`),`id` = LAST_INSERT_ID(`id`)"
+	if query != want {
+		t.Fatalf("buildUpsert() query = %s, want %s", query, want)
+	}
+	if !reflect.DeepEqual(args, []interface{}{2, "2020-01-01", 1}) {
+		t.Fatalf("buildUpsert() args = %v", args)
+	}
+	query, _ = buildUpsert("group_user", map[string]interface{}{"group_id": 1, "user_id": 2}, nil, "")
+	want = "INSERT INTO `group_user` (`group_id`,`user_id`) VALUES (?,?) ON DUPLICATE KEY UPDATE `group_id` = `group_id`"
+	if query != want {
+		t.Fatalf("buildUpsert() query = %s, want %s", query, want)
+	}
+}
+
+func TestBuildUpdate(t *testing.T) {
+	query, args, locked, err := buildUpdate("user", map[string]interface{}{"id": 1, "name": "a", "age": 2}, []string{"id"}, "")
+	want := "UPDATE `user` SET  `age` = ? , `name` = ?  WHERE `id` = ?  LIMIT 1"
+	if err != nil || locked || query != want || !reflect.DeepEqual(args, []interface{}{2, "a", 1}) {
+		t.Fatalf("buildUpdate() = %s %v %v %v, want %s", query, args, locked, err, want)
+	}
+
+	query, args, locked, err = buildUpdate("user", map[string]interface{}{"id": 1, "name": "a", Version: 3}, []string{"id"}, Version)
+	want = "UPDATE `user` SET  `name` = ? ,`version` = `version` + 1  WHERE `id` = ? AND`version` = ?  LIMIT 1"
+	if err != nil || !locked || query != want || !reflect.DeepEqual(args, []interface{}{"a", 1, 3}) {
+		t.Fatalf("buildUpdate() with version = %s %v %v %v, want %s", query, args, locked, err, want)
+	}
+
+	query, args, locked, err = buildUpdate("user", map[string]interface{}{"id": 1, "name": "a"}, []string{"id"}, Version)
+	want = "UPDATE `user` SET  `name` = ? ,`version` = `version` + 1  WHERE `id` = ?  LIMIT 1"
+	if err != nil || locked || query != want || !reflect.DeepEqual(args, []interface{}{"a", 1}) {
+		t.Fatalf("buildUpdate() without version value = %s %v %v %v, want %s", query, args, locked, err, want)
+	}
+
+	if _, _, _, err = buildUpdate("user", map[string]interface{}{"name": "a"}, []string{"id"}, ""); err != ErrNoUpdateKey {
+		t.Fatalf("buildUpdate() without key = %v, want %v", err, ErrNoUpdateKey)
+	}
+}
+
+type VersionDoc struct {
+	ID      int
+	Title   string
+	Version int
+}
+
+func TestUpdate_OptimisticLock(t *testing.T) {
+	db, fdb := newFakeDataBase(t, map[string][]string{"version_doc": {"id", "title", "version"}})
+	db.OptimisticLock()
+	var affected int64
+	fdb.exec = func(query string, args []driver.Value) (driver.Result, error) {
+		return driver.RowsAffected(affected), nil
+	}
+
+	affected = 1
+	if err := db.Table("version_doc").Update(map[string]interface{}{"id": 1, "title": "a", "version": 3}); err != nil {
+		t.Fatalf("Table.Update() = %v", err)
+	}
+	affected = 0
+	if err := db.Table("version_doc").Update(map[string]interface{}{"id": 1, "title": "a", "version": 3}); err != ErrStaleObject {
+		t.Fatalf("Table.Update() of a stale row = %v, want %v", err, ErrStaleObject)
+	}
+	if err := db.Table("version_doc").Update(map[string]interface{}{"id": 1, "title": "a"}); err != nil {
+		t.Fatalf("Table.Update() without version = %v", err)
+	}
+
+	doc := &VersionDoc{ID: 1, Title: "a", Version: 3}
+	affected = 1
+	if err := db.Update(doc); err != nil || doc.Version != 4 {
+		t.Fatalf("Update() = %v, version %d, want 4", err, doc.Version)
+	}
+	stmts := fdb.statements()
+	i := len(stmts) - 1
+	for i > 0 && !strings.HasPrefix(stmts[i], "UPDATE") {
+		i--
+	}
+	if stmts[i] != "UPDATE `version_doc` SET  `title` = ? ,`version` = `version` + 1  WHERE `id` = ? AND`version` = ?  LIMIT 1" {
+		t.Fatalf("Update() SQL = %v", stmts)
+	}
+	if args := fdb.args[i]; !reflect.DeepEqual(args, []driver.Value{"a", int64(1), int64(3)}) {
+		t.Fatalf("Update() args = %v", args)
+	}
+	affected = 0
+	if err := db.Update(doc); err != ErrStaleObject || doc.Version != 4 {
+		t.Fatalf("Update() of a stale row = %v, version %d, want %v and 4", err, doc.Version, ErrStaleObject)
+	}
+}
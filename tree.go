@@ -0,0 +1,141 @@
+package crud
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// TreeOption RowsMap.Tree的参数
+type TreeOption struct {
+	IsRoot    func(RowMap) bool // 判断是否为根节点，默认父ID为空、"0"或者父节点不存在的为根节点
+	SortField string            // 兄弟节点按照这个字段排序，都是数字的时候按照数字排序，默认保持原来的顺序
+	SortDesc  bool
+	DepthKey  string // 不为空时在节点中加入深度，根节点为0
+	PathKey   string // 不为空时在节点中加入从根节点到当前节点的ID路径
+	PathSep   string // 路径的分隔符，默认为/
+}
+
+// Tree 将id/parent_id形式的邻接表转换成树，子节点放在childrenKey中(没有子节点时为空数组)，可以直接输出JSON。
+// 有环的时候返回已经构建好的部分和ErrTreeCycle。
+func (rm RowsMap) Tree(idField, parentField, childrenKey string, opts ...TreeOption) ([]RowMapInterface, error) {
+	var opt TreeOption
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
+	if opt.PathSep == "" {
+		opt.PathSep = "/"
+	}
+	index := make(map[string]int, len(rm))
+	for i, r := range rm {
+		if _, ok := index[r[idField]]; !ok {
+			index[r[idField]] = i
+		}
+	}
+	isRoot := opt.IsRoot
+	if isRoot == nil {
+		isRoot = func(r RowMap) bool {
+			pid := r[parentField]
+			if pid == "" || pid == "0" {
+				return true
+			}
+			_, ok := index[pid]
+			return !ok
+		}
+	}
+	children := make(map[string][]int, len(rm))
+	roots := []int{}
+	for i, r := range rm {
+		if isRoot(r) {
+			roots = append(roots, i)
+			continue
+		}
+		children[r[parentField]] = append(children[r[parentField]], i)
+	}
+
+	less := func(idxs []int) {
+		if opt.SortField == "" {
+			return
+		}
+		sort.SliceStable(idxs, func(i, j int) bool {
+			a, b := rm[idxs[i]][opt.SortField], rm[idxs[j]][opt.SortField]
+			c := compareValue(a, b)
+			if opt.SortDesc {
+				return c > 0
+			}
+			return c < 0
+		})
+	}
+
+	var (
+		visited = make([]bool, len(rm))
+		cycle   []string
+		build   func(i, depth int, path []string) RowMapInterface
+	)
+	build = func(i, depth int, path []string) RowMapInterface {
+		r := rm[i]
+		visited[i] = true
+		node := r.Interface()
+		path = append(path[:len(path):len(path)], r[idField])
+		if opt.DepthKey != "" {
+			node[opt.DepthKey] = depth
+		}
+		if opt.PathKey != "" {
+			node[opt.PathKey] = strings.Join(path, opt.PathSep)
+		}
+		kids := make([]RowMapInterface, 0)
+		idxs := append([]int(nil), children[r[idField]]...)
+		less(idxs)
+		for _, ci := range idxs {
+			if visited[ci] {
+				cycle = append(cycle, rm[ci][idField])
+				continue
+			}
+			kids = append(kids, build(ci, depth+1, path))
+		}
+		node[childrenKey] = kids
+		return node
+	}
+
+	less(roots)
+	forest := make([]RowMapInterface, 0, len(roots))
+	for _, i := range roots {
+		if visited[i] {
+			continue
+		}
+		forest = append(forest, build(i, 0, nil))
+	}
+
+	// 没有被访问到的节点，如果沿着父节点能回到自己就是环，否则只是不在IsRoot指定的根节点下面。
+	for i := range rm {
+		if visited[i] {
+			continue
+		}
+		seen := map[int]bool{}
+		for j, ok := i, true; ok && !visited[j]; j, ok = index[rm[j][parentField]] {
+			if seen[j] {
+				cycle = append(cycle, rm[j][idField])
+				break
+			}
+			seen[j] = true
+		}
+		// 同一个环只报告一次
+		for j := range seen {
+			visited[j] = true
+		}
+	}
+	if len(cycle) > 0 {
+		return forest, fmt.Errorf("%w: %s", ErrTreeCycle, strings.Join(cycle, ","))
+	}
+	return forest, nil
+}
+
+// compareValue 都是数字的时候按照数字比较，否则按照字符串比较。
+func compareValue(a, b string) int {
+	x, _, okx := parseDecimal(a)
+	y, _, oky := parseDecimal(b)
+	if okx && oky {
+		return x.Cmp(y)
+	}
+	return strings.Compare(a, b)
+}
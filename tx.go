@@ -0,0 +1,162 @@
+package crud
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrNotInTx 不在事务中的时候Commit、Rollback返回的错误
+var ErrNotInTx = errors.New("不在事务中")
+
+// sqlConn *sql.DB和*sql.Tx共同的方法
+type sqlConn interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// clone 复制一个DataBase，表结构、钩子等和原来的共用。
+func (db *DataBase) clone() *DataBase {
+	ndb := *db
+	return &ndb
+}
+
+// conn 当前的链接，在事务中的时候为事务。
+func (db *DataBase) conn() sqlConn {
+	if db.tx != nil {
+		return db.tx
+	}
+	return db.db
+}
+
+// WithContext 返回一个使用ctx执行SQL的DataBase，原来的DataBase不受影响。
+func (db *DataBase) WithContext(ctx context.Context) *DataBase {
+	ndb := db.clone()
+	ndb.ctx = ctx
+	return ndb
+}
+
+// Context 执行SQL时使用的context，没有设置的时候为context.Background()。
+func (db *DataBase) Context() context.Context {
+	if db.ctx == nil {
+		return context.Background()
+	}
+	return db.ctx
+}
+
+// InTx 是否在事务中
+func (db *DataBase) InTx() bool {
+	return db.tx != nil
+}
+
+// Begin 开始一个事务，返回的DataBase中所有的操作都在这个事务中执行，最后需要Commit或者Rollback。
+func (db *DataBase) Begin() (*DataBase, error) {
+	tx, err := db.DB().BeginTx(db.Context(), nil)
+	if err != nil {
+		return nil, err
+	}
+	ndb := db.clone()
+	ndb.tx = tx
+	ndb.txDone = &txCallbacks{}
+	return ndb, nil
+}
+
+// Commit 提交事务
+func (db *DataBase) Commit() error {
+	if db.tx == nil {
+		return ErrNotInTx
+	}
+	err := db.tx.Commit()
+	db.txDone.run(err == nil)
+	return err
+}
+
+// Rollback 回滚事务
+func (db *DataBase) Rollback() error {
+	if db.tx == nil {
+		return ErrNotInTx
+	}
+	err := db.tx.Rollback()
+	db.txDone.run(false)
+	return err
+}
+
+// txCallbacks 事务结束之后执行的函数，同一个事务中的DataBase共用。
+type txCallbacks struct {
+	mu       sync.Mutex
+	commit   []func()
+	rollback []func()
+}
+
+// run 事务结束之后调用，committed为是否提交成功，每个函数只会执行一次。
+func (c *txCallbacks) run(committed bool) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	fs := c.rollback
+	if committed {
+		fs = c.commit
+	}
+	c.commit, c.rollback = nil, nil
+	c.mu.Unlock()
+	for _, f := range fs {
+		f()
+	}
+}
+
+// afterTx 在事务中的时候onCommit在事务提交之后执行，onRollback在事务回滚之后执行；
+// 不在事务中的时候直接执行onCommit。函数为nil的时候忽略。
+func (db *DataBase) afterTx(onCommit, onRollback func()) {
+	if db.tx == nil || db.txDone == nil {
+		if onCommit != nil {
+			onCommit()
+		}
+		return
+	}
+	c := db.txDone
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if onCommit != nil {
+		c.commit = append(c.commit, onCommit)
+	}
+	if onRollback != nil {
+		c.rollback = append(c.rollback, onRollback)
+	}
+}
+
+// Transaction 在事务中执行f，f返回error或者panic的时候回滚，否则提交。
+// 已经在事务中的时候直接在当前事务中执行f，由外层的事务提交或者回滚。
+func (db *DataBase) Transaction(f func(tx *DataBase) error) (err error) {
+	if db.tx != nil {
+		return f(db)
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+			panic(r)
+		}
+	}()
+	if err = f(tx); err != nil {
+		if rerr := tx.Rollback(); rerr != nil {
+			return fmt.Errorf("%w (回滚失败: %v)", err, rerr)
+		}
+		return err
+	}
+	return tx.Commit()
+}
+
+// transaction need为true的时候在事务中执行f(见Transaction)，否则直接使用当前的DataBase执行f，
+// 已经在事务中的时候都在这个事务中执行。只有一条语句的时候不需要BEGIN、COMMIT。
+func (db *DataBase) transaction(need bool, f func(tx *DataBase) error) error {
+	if !need {
+		return f(db)
+	}
+	return db.Transaction(f)
+}
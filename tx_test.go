@@ -0,0 +1,137 @@
+package crud
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestCommitNotInTx(t *testing.T) {
+	db := newTestDataBase(nil)
+	if db.InTx() {
+		t.Fatal("InTx() = true outside a transaction")
+	}
+	if err := db.Commit(); err != ErrNotInTx {
+		t.Fatalf("Commit() err = %v, want ErrNotInTx", err)
+	}
+	if err := db.Rollback(); err != ErrNotInTx {
+		t.Fatalf("Rollback() err = %v, want ErrNotInTx", err)
+	}
+}
+
+func TestTransaction(t *testing.T) {
+	db, fdb := newFakeDataBase(t, map[string][]string{"user": {"id", "name"}})
+	err := db.Transaction(func(tx *DataBase) error {
+		if !tx.InTx() {
+			t.Fatal("InTx() = false inside Transaction")
+		}
+		tx.Exec("UPDATE user SET name = ?", "a")
+		// 嵌套的Transaction在外层的事务中执行
+		return tx.Transaction(func(inner *DataBase) error {
+			inner.Exec("DELETE FROM user")
+			return nil
+		})
+	})
+	want := []string{"BEGIN", "UPDATE user SET name = ?", "DELETE FROM user", "COMMIT"}
+	if err != nil || !reflect.DeepEqual(fdb.statements(), want) {
+		t.Fatalf("Transaction() = %v %v, want %v", fdb.statements(), err, want)
+	}
+
+	errFail := errors.New("fail")
+	db, fdb = newFakeDataBase(t, map[string][]string{"user": {"id", "name"}})
+	if err := db.Transaction(func(tx *DataBase) error { return errFail }); err != errFail {
+		t.Fatalf("Transaction() = %v, want %v", err, errFail)
+	}
+	func() {
+		defer func() {
+			if r := recover(); r != "boom" {
+				t.Fatalf("Transaction() recover() = %v, want boom", r)
+			}
+		}()
+		db.Transaction(func(tx *DataBase) error { panic("boom") })
+	}()
+	if want := []string{"BEGIN", "ROLLBACK", "BEGIN", "ROLLBACK"}; !reflect.DeepEqual(fdb.statements(), want) {
+		t.Fatalf("Transaction() rollback = %v, want %v", fdb.statements(), want)
+	}
+}
+
+type TxPlain struct {
+	ID   int
+	Name string
+}
+
+type TxHooked struct {
+	ID   int
+	Name string
+}
+
+func (u *TxHooked) BeforeCreate(ctx context.Context, tx *DataBase) error {
+	return nil
+}
+
+func (u *TxHooked) AfterDelete(ctx context.Context, tx *DataBase) error {
+	return nil
+}
+
+func TestWriteTransaction(t *testing.T) {
+	db, fdb := newFakeDataBase(t, map[string][]string{"tx_plain": {"id", "name"}, "tx_hooked": {"id", "name"}})
+	count := func(stmt string) int {
+		n := 0
+		for _, s := range fdb.statements() {
+			if s == stmt {
+				n++
+			}
+		}
+		return n
+	}
+
+	// 没有钩子和关联的时候只执行一条语句，不开启事务
+	if _, err := db.Create(&TxPlain{Name: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Update(&TxPlain{ID: 1, Name: "b"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Delete(&TxPlain{ID: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if n := count("BEGIN"); n != 0 {
+		t.Fatalf("writes without hooks began %d transactions: %v", n, fdb.statements())
+	}
+
+	// 有钩子的时候在事务中执行
+	if _, err := db.Create(&TxHooked{Name: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Delete(&TxHooked{ID: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Update(&TxHooked{ID: 1, Name: "b"}); err != nil {
+		t.Fatal(err)
+	}
+	if b, c := count("BEGIN"), count("COMMIT"); b != 2 || c != 2 {
+		t.Fatalf("writes with hooks began %d and committed %d transactions: %v", b, c, fdb.statements())
+	}
+
+	// 全局的钩子
+	db.RegisterHook(AfterUpdate, func(ctx context.Context, tx *DataBase, obj interface{}) error { return nil })
+	if err := db.Update(&TxPlain{ID: 1, Name: "c"}); err != nil {
+		t.Fatal(err)
+	}
+	if n := count("BEGIN"); n != 3 {
+		t.Fatalf("update with a global hook began %d transactions in total: %v", n, fdb.statements())
+	}
+
+	// 在调用者的事务中执行
+	err := db.Transaction(func(tx *DataBase) error {
+		if _, err := tx.Create(&TxHooked{Name: "d"}); err != nil {
+			return err
+		}
+		_, err := tx.Create(&TxPlain{Name: "d"})
+		return err
+	})
+	if err != nil || count("BEGIN") != 4 || count("COMMIT") != 4 {
+		t.Fatalf("writes inside Transaction = %v %v", fdb.statements(), err)
+	}
+}
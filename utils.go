@@ -141,23 +141,9 @@ func argslice(l int) string {
 }
 
 // structToMap 将结构体转换成map[string]interface{}
+// 字段规则见model.go中的tag说明，忽略的字段和关联的结构体不会放到map中。
 func structToMap(v reflect.Value) map[string]interface{} {
-	v = reflect.Indirect(v)
-	t := v.Type()
-	m := map[string]interface{}{}
-
-	for i, num := 0, v.NumField(); i < num; i++ {
-		tag := t.Field(i).Tag
-		if tag.Get("crud") != "ignore" && tag.Get("crud") != "-" {
-			if tag.Get("dbname") != "" {
-				m[tag.Get("dbname")] = v.Field(i).Interface()
-			} else {
-				m[ToDBName(t.Field(i).Name)] = v.Field(i).Interface()
-			}
-		}
-	}
-
-	return m
+	return getModel(v.Type()).toMap(v, false, false)
 }
 
 // Placeholder sql占位